@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/verniyyy/verniy-mq/src"
+)
+
+// aclCmd represents the acl command
+var aclCmd = &cobra.Command{
+	Use:   "acl",
+	Short: "Share queues with other accounts on a running server",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		cmd.SilenceUsage = true
+	},
+}
+
+// aclListCmd represents the acl list command
+var aclListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the grants on the queues of the account",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return apiRequest(http.MethodGet, "/api/v1/acl/", nil, nil)
+	},
+}
+
+// aclGrantCmd represents the acl grant command
+var aclGrantCmd = &cobra.Command{
+	Use:   "grant <grantee> <queue pattern> <permission>[,<permission>...]",
+	Short: "Grant permissions on the queues matching a pattern",
+	Long: `Grant permissions on the queues matching a pattern to another account
+(account:<account ID>) or to the accounts with a role (role:<role>).
+Permissions are publish, consume, delete and manage.`,
+	Example: `  verniy-mq acl grant account:billing 'orders-*' consume,delete`,
+	Args:    cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		g := src.Grant{Grantee: args[0], Queue: args[1]}
+		for _, p := range strings.Split(args[2], ",") {
+			g.Permissions = append(g.Permissions, src.Permission(p))
+		}
+		return apiRequest(http.MethodPost, "/api/v1/acl/", nil, g)
+	},
+}
+
+// aclRevokeCmd represents the acl revoke command
+var aclRevokeCmd = &cobra.Command{
+	Use:   "revoke <grantee> <queue pattern>",
+	Short: "Revoke a grant",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := url.Values{}
+		query.Set("grantee", args[0])
+		query.Set("queue", args[1])
+		return apiRequest(http.MethodDelete, "/api/v1/acl/", query, nil)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(aclCmd)
+	addClientFlags(aclCmd)
+
+	aclCmd.AddCommand(aclListCmd)
+	aclCmd.AddCommand(aclGrantCmd)
+	aclCmd.AddCommand(aclRevokeCmd)
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	osuser "os/user"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/verniyyy/verniy-mq/src"
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the audit log",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		cmd.SilenceUsage = true
+	},
+}
+
+// auditVerifyCmd represents the audit verify command
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify [file]",
+	Short: "Verify the hash chain of the audit log and its rotated files",
+	Long: `Verify the hash chain of the audit log, audit.file of the config file by
+default, through its rotated files from the oldest to the newest. The last
+hash printed can be kept elsewhere to detect the log being rewritten as a whole.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := viper.GetString("audit.file")
+		if len(args) > 0 {
+			path = args[0]
+		}
+		if path == "" {
+			return errors.New("no audit log, give a file or set audit.file")
+		}
+
+		files, err := src.AuditLogFiles(path)
+		if err != nil {
+			return err
+		}
+		res, err := src.VerifyAuditLog(files)
+		if err != nil {
+			return err
+		}
+		if res.Events == 0 {
+			fmt.Println("no events")
+			return nil
+		}
+		fmt.Printf("ok: %d events, seq %d to %d in %d files\n", res.Events, res.FirstSeq, res.LastSeq, len(files))
+		fmt.Printf("last hash: %s\n", res.LastHash)
+		return nil
+	},
+}
+
+// openAuditLog opens the audit log of the config file, nil when audit.file is not set.
+func openAuditLog() (*src.AuditLog, error) {
+	path := viper.GetString("audit.file")
+	if path == "" {
+		return nil, nil
+	}
+	return src.OpenAuditLog(src.AuditLogConfig{
+		Path:       path,
+		MaxSize:    int64(viper.GetSizeInBytes("audit.max_size")),
+		MaxBackups: viper.GetInt("audit.max_backups"),
+	})
+}
+
+// recordAccountChange makes change, an account change of a user
+// subcommand, and records it to the audit log of the config file as typ on
+// accountID. The log is opened first so that nothing is changed when it can
+// not be written.
+func recordAccountChange(typ, accountID string, change func() (detail string, err error)) error {
+	audit, err := openAuditLog()
+	if err != nil {
+		return err
+	}
+	defer audit.Close()
+
+	detail, err := change()
+	e := src.NewAuditEvent(context.Background(), typ, err)
+	e.Owner = accountID
+	operator := "cli user=" + osUser()
+	switch {
+	case e.Detail != "":
+		e.Detail = operator + ": " + e.Detail
+	case detail != "":
+		e.Detail = operator + " " + detail
+	default:
+		e.Detail = operator
+	}
+	audit.Record(e)
+	return err
+}
+
+// osUser returns the name of the user running the command.
+func osUser() string {
+	if u, err := osuser.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditVerifyCmd)
+}
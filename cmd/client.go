@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serverURL string
+	userID    string
+	namespace string
+	user      string
+	password  string
+	apiKey    string
+	caFile    string
+	certFile  string
+	keyFile   string
+)
+
+// addClientFlags adds the flags of commands talking to a running server.
+func addClientFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&serverURL, "server", "http://localhost:8000", "HTTP API address of the server")
+	cmd.PersistentFlags().StringVar(&userID, "uid", "", "account to work on instead of the authenticated one (admin only)")
+	cmd.PersistentFlags().StringVar(&user, "user", os.Getenv("VMQ_USER"), "account ID to authenticate as, $VMQ_USER by default")
+	cmd.PersistentFlags().StringVar(&password, "password", os.Getenv("VMQ_PASSWORD"), "password of --user, $VMQ_PASSWORD by default")
+	defaultAPIKey := os.Getenv("VMQ_API_KEY")
+	if defaultAPIKey == "" {
+		defaultAPIKey = os.Getenv("VMQ_TOKEN")
+	}
+	cmd.PersistentFlags().StringVar(&apiKey, "api-key", defaultAPIKey, "API key or JWT to authenticate with instead of --user, $VMQ_API_KEY by default")
+	// API tokens became API keys
+	cmd.PersistentFlags().StringVar(&apiKey, "token", defaultAPIKey, "API key to authenticate with")
+	cmd.PersistentFlags().MarkDeprecated("token", "use --api-key instead")
+	cmd.PersistentFlags().StringVar(&namespace, "namespace", "", "namespace of the account, the default one if empty")
+	cmd.PersistentFlags().StringVar(&caFile, "ca-file", "", "PEM CA certificates to verify an https server with instead of the system ones")
+	cmd.PersistentFlags().StringVar(&certFile, "cert", "", "client certificate to authenticate with over https")
+	cmd.PersistentFlags().StringVar(&keyFile, "key", "", "key of --cert")
+}
+
+// httpClient returns a client with the TLS settings of the flags.
+func httpClient() (*http.Client, error) {
+	if caFile == "" && certFile == "" {
+		return http.DefaultClient, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", caFile)
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	return &http.Client{Transport: transport}, nil
+}
+
+// apiRequest calls the HTTP API and prints the JSON response.
+func apiRequest(method, path string, query url.Values, body any) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	if userID != "" {
+		query.Set("uid", userID)
+	}
+	u := strings.TrimRight(serverURL, "/") + path + "?" + query.Encode()
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = strings.NewReader(string(b))
+	}
+
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case user != "":
+		req.SetBasicAuth(user, password)
+	case apiKey != "":
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	if namespace != "" {
+		req.Header.Set("X-Vmq-Namespace", namespace)
+	}
+
+	client, err := httpClient()
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(b)))
+	}
+	if len(b) > 0 {
+		fmt.Fprint(os.Stdout, string(b))
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// queueCmd represents the queue command
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Manage queues on a running server",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// errors from here on come from the server rather than from wrong usage
+		cmd.SilenceUsage = true
+	},
+}
+
+// queueAttributesCmd represents the queue attributes command
+var queueAttributesCmd = &cobra.Command{
+	Use:   "attributes <queue name>",
+	Short: "Show attributes and statistics of a queue",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return apiRequest(http.MethodGet, "/api/v1/vmq/"+url.PathEscape(args[0]), nil, nil)
+	},
+}
+
+// queueSetAttributesCmd represents the queue set-attributes command
+var queueSetAttributesCmd = &cobra.Command{
+	Use:     "set-attributes <queue name> <json>",
+	Short:   "Update attributes of a queue",
+	Example: `  verniy-mq queue set-attributes orders '{"visibility_timeout":"30s","max_length":1000}'`,
+	Args:    cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return apiRequest(http.MethodPatch, "/api/v1/vmq/"+url.PathEscape(args[0]), nil, json.RawMessage(args[1]))
+	},
+}
+
+var tagSelector string
+
+// queuePurgeCmd represents the queue purge command
+var queuePurgeCmd = &cobra.Command{
+	Use:   "purge {<queue name> | --selector <tag selector>}",
+	Short: "Remove every message of a queue or the queues selected by tags (admin only)",
+	Args:  selectorOrName,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if tagSelector != "" {
+			query := url.Values{}
+			query.Set("selector", tagSelector)
+			return apiRequest(http.MethodPost, "/api/v1/vmq/purge", query, nil)
+		}
+		return apiRequest(http.MethodPost, "/api/v1/vmq/"+url.PathEscape(args[0])+"/purge", nil, nil)
+	},
+}
+
+// queueDeleteCmd represents the queue delete command
+var queueDeleteCmd = &cobra.Command{
+	Use:   "delete {<queue name> | --selector <tag selector>}",
+	Short: "Delete a queue or the queues selected by tags",
+	Args:  selectorOrName,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if tagSelector != "" {
+			query := url.Values{}
+			query.Set("selector", tagSelector)
+			return apiRequest(http.MethodDelete, "/api/v1/vmq/", query, nil)
+		}
+		return apiRequest(http.MethodDelete, "/api/v1/vmq/"+url.PathEscape(args[0]), nil, nil)
+	},
+}
+
+// selectorOrName accepts either a queue name or the --selector flag.
+func selectorOrName(cmd *cobra.Command, args []string) error {
+	if tagSelector != "" {
+		return cobra.NoArgs(cmd, args)
+	}
+	return cobra.ExactArgs(1)(cmd, args)
+}
+
+// queueTagsCmd represents the queue tags command
+var queueTagsCmd = &cobra.Command{
+	Use:   "tags <queue name>",
+	Short: "Show tags of a queue",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return apiRequest(http.MethodGet, "/api/v1/vmq/"+url.PathEscape(args[0])+"/tags", nil, nil)
+	},
+}
+
+// queueTagCmd represents the queue tag command
+var queueTagCmd = &cobra.Command{
+	Use:     "tag <queue name> <key=value>...",
+	Short:   "Add tags to a queue",
+	Example: "  verniy-mq queue tag orders team=payments env=prod",
+	Args:    cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tags := make(map[string]string, len(args)-1)
+		for _, kv := range args[1:] {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				return fmt.Errorf("invalid tag: %s", kv)
+			}
+			tags[k] = v
+		}
+		return apiRequest(http.MethodPost, "/api/v1/vmq/"+url.PathEscape(args[0])+"/tags", nil, tags)
+	},
+}
+
+// queueUntagCmd represents the queue untag command
+var queueUntagCmd = &cobra.Command{
+	Use:   "untag <queue name> <key>...",
+	Short: "Remove tags from a queue",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := url.Values{}
+		query.Set("keys", strings.Join(args[1:], ","))
+		return apiRequest(http.MethodDelete, "/api/v1/vmq/"+url.PathEscape(args[0])+"/tags", query, nil)
+	},
+}
+
+var (
+	browseOffset   int
+	browseLimit    int
+	browseInFlight bool
+)
+
+// queueBrowseCmd represents the queue browse command
+var queueBrowseCmd = &cobra.Command{
+	Use:   "browse <queue name>",
+	Short: "Show messages of a queue without consuming them (admin only)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := url.Values{}
+		query.Set("offset", strconv.Itoa(browseOffset))
+		query.Set("limit", strconv.Itoa(browseLimit))
+		query.Set("in_flight", strconv.FormatBool(browseInFlight))
+		return apiRequest(http.MethodGet, "/api/v1/vmq/"+url.PathEscape(args[0])+"/messages", query, nil)
+	},
+}
+
+var (
+	pausePublish bool
+	pauseConsume bool
+)
+
+// queuePauseCmd represents the queue pause command
+var queuePauseCmd = &cobra.Command{
+	Use:   "pause <queue name>",
+	Short: "Pause publish and/or consume on a queue",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return apiRequest(http.MethodPost, "/api/v1/vmq/"+url.PathEscape(args[0])+"/pause", pauseQuery(), nil)
+	},
+}
+
+// queueResumeCmd represents the queue resume command
+var queueResumeCmd = &cobra.Command{
+	Use:   "resume <queue name>",
+	Short: "Resume publish and/or consume on a queue",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return apiRequest(http.MethodPost, "/api/v1/vmq/"+url.PathEscape(args[0])+"/resume", pauseQuery(), nil)
+	},
+}
+
+// pauseQuery ...
+func pauseQuery() url.Values {
+	query := url.Values{}
+	query.Set("publish", strconv.FormatBool(pausePublish))
+	query.Set("consume", strconv.FormatBool(pauseConsume))
+	return query
+}
+
+// queueRenameCmd represents the queue rename command
+var queueRenameCmd = &cobra.Command{
+	Use:   "rename <queue name> <new name>",
+	Short: "Rename a queue keeping its messages",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := url.Values{}
+		query.Set("to", args[1])
+		return apiRequest(http.MethodPost, "/api/v1/vmq/"+url.PathEscape(args[0])+"/rename", query, nil)
+	},
+}
+
+// queueTransferCmd represents the queue transfer command
+var queueTransferCmd = &cobra.Command{
+	Use:   "transfer <queue name> <account ID>",
+	Short: "Hand a queue to another account keeping its messages",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := url.Values{}
+		query.Set("to", args[1])
+		return apiRequest(http.MethodPost, "/api/v1/vmq/"+url.PathEscape(args[0])+"/transfer", query, nil)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(queueCmd)
+	addClientFlags(queueCmd)
+
+	queueCmd.AddCommand(queueAttributesCmd)
+	queueCmd.AddCommand(queueSetAttributesCmd)
+	queueCmd.AddCommand(queueRenameCmd)
+	queueCmd.AddCommand(queueTransferCmd)
+	queueCmd.AddCommand(queueTagsCmd)
+	queueCmd.AddCommand(queueTagCmd)
+	queueCmd.AddCommand(queueUntagCmd)
+
+	for _, c := range []*cobra.Command{queuePurgeCmd, queueDeleteCmd} {
+		c.Flags().StringVar(&tagSelector, "selector", "", "tag selector such as team=payments,env=prod")
+		queueCmd.AddCommand(c)
+	}
+
+	queueBrowseCmd.Flags().IntVar(&browseOffset, "offset", 0, "number of messages to skip")
+	queueBrowseCmd.Flags().IntVar(&browseLimit, "limit", 10, "maximum number of messages to show")
+	queueBrowseCmd.Flags().BoolVar(&browseInFlight, "in-flight", false, "include in-flight messages")
+	queueCmd.AddCommand(queueBrowseCmd)
+
+	for _, c := range []*cobra.Command{queuePauseCmd, queueResumeCmd} {
+		c.Flags().BoolVar(&pausePublish, "publish", false, "select publish")
+		c.Flags().BoolVar(&pauseConsume, "consume", false, "select consume")
+		queueCmd.AddCommand(c)
+	}
+}
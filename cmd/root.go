@@ -5,6 +5,7 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"runtime"
 
@@ -29,13 +30,103 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	Run: func(cmd *cobra.Command, args []string) {
-		mqm := src.NewMQManager()
-		go server.NewTCPServer("localhost", 9000, mqm).Run()
-		go server.NewHTTPServer("localhost", 8000, mqm).Run()
+		cfg := src.DefaultMQManagerConfig()
+		cfg.AdminAccountID = viper.GetString("admin.account_id")
+		cfg.AdminTopic = viper.GetString("admin.topic")
+		if viper.IsSet("expiry.grace_period") {
+			cfg.ExpiryGracePeriod = viper.GetDuration("expiry.grace_period")
+		}
+		if viper.IsSet("expiry.check_interval") {
+			cfg.ExpiryCheckInterval = viper.GetDuration("expiry.check_interval")
+		}
+
+		accounts, err := openAccountStore()
+		cobra.CheckErr(err)
+		if accounts.Len() == 0 {
+			log.Printf("no accounts in %s, add one with \"verniy-mq user add\"", dataDir())
+		}
+
+		defaultQuota := src.Quota{
+			MaxQueues:      viper.GetInt("quota.default.max_queues"),
+			MaxMessages:    viper.GetInt64("quota.default.max_messages"),
+			MaxBytes:       int64(viper.GetSizeInBytes("quota.default.max_bytes")),
+			MaxMessageSize: int64(viper.GetSizeInBytes("quota.default.max_message_size")),
+		}
+		cobra.CheckErr(defaultQuota.Validate())
+		cfg.Quotas = accounts.QuotaSource(defaultQuota)
+		cfg.RateLimits = src.RateLimits{
+			Publish: src.RateLimit{
+				Rate:  viper.GetFloat64("rate_limit.publish.rate"),
+				Burst: viper.GetInt("rate_limit.publish.burst"),
+			},
+			Consume: src.RateLimit{
+				Rate:  viper.GetFloat64("rate_limit.consume.rate"),
+				Burst: viper.GetInt("rate_limit.consume.burst"),
+			},
+		}
+		cobra.CheckErr(cfg.RateLimits.Validate())
+
+		mqm := src.NewMQManager(cfg)
+		serverCfg := server.Config{
+			AdminAccountIDs: viper.GetStringSlice("admin.accounts"),
+			Accounts:        accounts,
+			SessionLifetime: server.DefaultSessionLifetime,
+			IdleTimeout:     server.DefaultIdleTimeout,
+		}
+		serverCfg.Audit, err = openAuditLog()
+		cobra.CheckErr(err)
+		if viper.IsSet("session.lifetime") {
+			serverCfg.SessionLifetime = viper.GetDuration("session.lifetime")
+		}
+		if viper.IsSet("session.idle_timeout") {
+			serverCfg.IdleTimeout = viper.GetDuration("session.idle_timeout")
+		}
+		if viper.IsSet("max_message_size") {
+			serverCfg.MaxMessageSize = int64(viper.GetSizeInBytes("max_message_size"))
+		}
+		if viper.IsSet("tls.cert_file") {
+			serverCfg.TLS, err = server.NewTLSConfig(server.TLSOptions{
+				CertFile:     viper.GetString("tls.cert_file"),
+				KeyFile:      viper.GetString("tls.key_file"),
+				ClientCAFile: viper.GetString("tls.client_ca_file"),
+				ClientAuth:   viper.GetString("tls.client_auth"),
+			})
+			cobra.CheckErr(err)
+			serverCfg.CertAccounts = viper.GetBool("tls.cert_accounts")
+		}
+		if viper.IsSet("jwt.jwks_file") {
+			serverCfg.JWT, err = src.NewJWTVerifier(jwtConfig())
+			cobra.CheckErr(err)
+		}
+		go server.NewTCPServer("localhost", 9000, mqm, serverCfg).Run()
+		go server.NewHTTPServer("localhost", 8000, mqm, serverCfg).Run()
 		runtime.Goexit()
 	},
 }
 
+// jwtConfig reads the jwt section of the config file.
+func jwtConfig() src.JWTConfig {
+	cfg := src.DefaultJWTConfig()
+	cfg.JWKSFile = viper.GetString("jwt.jwks_file")
+	cfg.Issuer = viper.GetString("jwt.issuer")
+	cfg.Audience = viper.GetString("jwt.audience")
+	if viper.IsSet("jwt.leeway") {
+		cfg.Leeway = viper.GetDuration("jwt.leeway")
+	}
+	cfg.AllowAdmin = viper.GetBool("jwt.allow_admin")
+	for key, claim := range map[string]*string{
+		"jwt.account_claim":     &cfg.AccountClaim,
+		"jwt.roles_claim":       &cfg.RolesClaim,
+		"jwt.permissions_claim": &cfg.PermissionsClaim,
+		"jwt.queues_claim":      &cfg.QueuesClaim,
+	} {
+		if viper.IsSet(key) {
+			*claim = viper.GetString(key)
+		}
+	}
+	return cfg
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
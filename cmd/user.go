@@ -0,0 +1,351 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/verniyyy/verniy-mq/src"
+	"github.com/verniyyy/verniy-mq/src/util"
+	"golang.org/x/term"
+)
+
+// userCmd represents the user command
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage the accounts in the data directory",
+	Long: `Manage the accounts in the account store of the data directory.
+A running server picks up the changes without restarting.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		cmd.SilenceUsage = true
+	},
+}
+
+// userAddCmd represents the user add command
+var userAddCmd = &cobra.Command{
+	Use:   "add <account ID>",
+	Short: "Add an account, reading its password from the terminal or stdin",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accounts, err := openAccountStore()
+		if err != nil {
+			return err
+		}
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		return recordAccountChange(src.AuditAccountCreate, args[0], func() (string, error) {
+			return "", accounts.Add(args[0], password)
+		})
+	},
+}
+
+// userRemoveCmd represents the user remove command
+var userRemoveCmd = &cobra.Command{
+	Use:   "remove <account ID>",
+	Short: "Remove an account",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accounts, err := openAccountStore()
+		if err != nil {
+			return err
+		}
+		return recordAccountChange(src.AuditAccountDelete, args[0], func() (string, error) {
+			return "", accounts.Remove(args[0])
+		})
+	},
+}
+
+// userPasswdCmd represents the user passwd command
+var userPasswdCmd = &cobra.Command{
+	Use:   "passwd <account ID>",
+	Short: "Change the password of an account, reading it from the terminal or stdin",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accounts, err := openAccountStore()
+		if err != nil {
+			return err
+		}
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		return recordAccountChange(src.AuditAccountPassword, args[0], func() (string, error) {
+			return "", accounts.SetPassword(args[0], password)
+		})
+	},
+}
+
+// userListCmd represents the user list command
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the accounts",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accounts, err := openAccountStore()
+		if err != nil {
+			return err
+		}
+		list, err := accounts.List()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tROLES\tCREATED\tUPDATED")
+		for _, a := range list {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.ID, strings.Join(a.Roles, ","), a.CreatedAt.Format(time.RFC3339), a.UpdatedAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+	},
+}
+
+// userRolesCmd represents the user roles command
+var userRolesCmd = &cobra.Command{
+	Use:   "roles <account ID> [<role>...]",
+	Short: "Set the roles of an account, which grants can be given to",
+	Long: `Set the roles of an account, replacing the current ones.
+Without roles the account is left without any.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accounts, err := openAccountStore()
+		if err != nil {
+			return err
+		}
+		return recordAccountChange(src.AuditAccountRoles, args[0], func() (string, error) {
+			return fmt.Sprintf("roles=%v", args[1:]), accounts.SetRoles(args[0], args[1:])
+		})
+	},
+}
+
+// userKeyCmd represents the user key command
+var userKeyCmd = &cobra.Command{
+	Use: "key",
+	// API tokens became API keys
+	Aliases: []string{"token"},
+	Short:   "Manage the API keys of an account",
+}
+
+var (
+	keyName        string
+	keyPermissions []string
+	keyQueues      []string
+	keyExpiresIn   string
+)
+
+// userKeyCreateCmd represents the user key create command
+var userKeyCreateCmd = &cobra.Command{
+	Use:     "create <account ID>",
+	Short:   "Create an API key and print it, it can not be shown again",
+	Example: `  verniy-mq user key create shop --name checkout --permissions publish --queues 'orders-*' --expires-in 90d`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accounts, err := openAccountStore()
+		if err != nil {
+			return err
+		}
+		expiresIn, err := parseLifetime(keyExpiresIn)
+		if err != nil {
+			return err
+		}
+		in := src.CreateAPIKeyInput{
+			Name:      keyName,
+			ExpiresIn: util.Duration(expiresIn),
+		}
+		if len(keyPermissions) > 0 || len(keyQueues) > 0 {
+			in.Scope = &src.APIKeyScope{Queues: keyQueues}
+			for _, p := range keyPermissions {
+				in.Scope.Permissions = append(in.Scope.Permissions, src.Permission(p))
+			}
+		}
+
+		return recordAccountChange(src.AuditAPIKeyCreate, args[0], func() (string, error) {
+			key, k, err := accounts.CreateAPIKey(args[0], in)
+			if err != nil {
+				return "", err
+			}
+			fmt.Println(key)
+			return "key_id=" + k.ID, nil
+		})
+	},
+}
+
+// userKeyListCmd represents the user key list command
+var userKeyListCmd = &cobra.Command{
+	Use:   "list <account ID>",
+	Short: "List the API keys of an account",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accounts, err := openAccountStore()
+		if err != nil {
+			return err
+		}
+		keys, err := accounts.APIKeys(args[0])
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPERMISSIONS\tQUEUES\tEXPIRES\tSTATUS")
+		for _, k := range keys {
+			permissions, queues := "*", "*"
+			if k.Scope != nil {
+				if len(k.Scope.Permissions) > 0 {
+					permissions = fmt.Sprint(k.Scope.Permissions)
+				}
+				if len(k.Scope.Queues) > 0 {
+					queues = strings.Join(k.Scope.Queues, ",")
+				}
+			}
+			expires, status := "never", "active"
+			if k.ExpiresAt != nil {
+				expires = k.ExpiresAt.Format(time.RFC3339)
+				if !time.Now().Before(*k.ExpiresAt) {
+					status = "expired"
+				}
+			}
+			if k.Revoked {
+				status = "revoked"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, permissions, queues, expires, status)
+		}
+		return w.Flush()
+	},
+}
+
+// userKeyRevokeCmd represents the user key revoke command
+var userKeyRevokeCmd = &cobra.Command{
+	Use:   "revoke <account ID> <key ID>",
+	Short: "Revoke an API key",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accounts, err := openAccountStore()
+		if err != nil {
+			return err
+		}
+		return recordAccountChange(src.AuditAPIKeyRevoke, args[0], func() (string, error) {
+			return "key_id=" + args[1], accounts.RevokeAPIKey(args[0], args[1])
+		})
+	},
+}
+
+// parseLifetime parses a duration which may also be given in days such as "90d".
+// Empty is zero.
+func parseLifetime(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid lifetime: %s", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// dataDir returns the directory the server keeps its state in.
+func dataDir() string {
+	if viper.IsSet("data_dir") {
+		return viper.GetString("data_dir")
+	}
+	return "data"
+}
+
+// openAccountStore ...
+func openAccountStore() (*src.AccountStore, error) {
+	return src.NewAccountStore(filepath.Join(dataDir(), src.AccountsFileName))
+}
+
+// readPassword reads a password without echo from the terminal, or the first line of stdin.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	confirm, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(password) != string(confirm) {
+		return "", errors.New("passwords do not match")
+	}
+	return string(password), nil
+}
+
+// userQuotaCmd represents the user quota command
+var userQuotaCmd = &cobra.Command{
+	Use:   "quota <account ID>",
+	Short: "Set the quota of an account",
+	Long: `Set the quota of an account, replacing the default quota of the config
+file. Zero limits are unlimited; --reset goes back to the default quota.`,
+	Example: `  verniy-mq user quota shop --max-queues 50 --max-messages 1000000 --max-bytes 1073741824`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accounts, err := openAccountStore()
+		if err != nil {
+			return err
+		}
+		q := &quota
+		if quotaReset {
+			q = nil
+		}
+		return recordAccountChange(src.AuditAccountQuota, args[0], func() (string, error) {
+			return fmt.Sprintf("quota=%+v", q), accounts.SetQuota(args[0], q)
+		})
+	},
+}
+
+var (
+	quota      src.Quota
+	quotaReset bool
+)
+
+func init() {
+	rootCmd.AddCommand(userCmd)
+	userCmd.AddCommand(userAddCmd)
+	userCmd.AddCommand(userRemoveCmd)
+	userCmd.AddCommand(userPasswdCmd)
+	userCmd.AddCommand(userListCmd)
+	userCmd.AddCommand(userRolesCmd)
+
+	userQuotaCmd.Flags().IntVar(&quota.MaxQueues, "max-queues", 0, "max queues over all namespaces")
+	userQuotaCmd.Flags().Int64Var(&quota.MaxMessages, "max-messages", 0, "max messages held by the queues")
+	userQuotaCmd.Flags().Int64Var(&quota.MaxBytes, "max-bytes", 0, "max bytes of the messages held by the queues")
+	userQuotaCmd.Flags().Int64Var(&quota.MaxMessageSize, "max-message-size", 0, "max size of a message in bytes")
+	userQuotaCmd.Flags().BoolVar(&quotaReset, "reset", false, "use the default quota")
+	userCmd.AddCommand(userQuotaCmd)
+
+	userKeyCreateCmd.Flags().StringVar(&keyName, "name", "", "name telling what the key is for")
+	userKeyCreateCmd.Flags().StringSliceVar(&keyPermissions, "permissions", nil, "operations the key is limited to: publish, consume, delete, manage")
+	userKeyCreateCmd.Flags().StringSliceVar(&keyQueues, "queues", nil, "queue name patterns the key is limited to")
+	userKeyCreateCmd.Flags().StringVar(&keyExpiresIn, "expires-in", "", "lifetime of the key such as 90d or 12h, never expires if empty")
+	userKeyCmd.AddCommand(userKeyCreateCmd)
+	userKeyCmd.AddCommand(userKeyListCmd)
+	userKeyCmd.AddCommand(userKeyRevokeCmd)
+	userCmd.AddCommand(userKeyCmd)
+}
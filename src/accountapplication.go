@@ -0,0 +1,107 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// AccountApplication manages accounts. Every operation is for admins.
+type AccountApplication struct {
+	accounts *AccountStore
+	audit    *AuditLog
+}
+
+// NewAccountApplication returns the application recording its operations
+// to audit, which may be nil.
+func NewAccountApplication(accounts *AccountStore, audit *AuditLog) AccountApplication {
+	return AccountApplication{
+		accounts: accounts,
+		audit:    audit,
+	}
+}
+
+// CreateAPIKey issues an API key for accountID.
+func (a AccountApplication) CreateAPIKey(ctx context.Context, accountID string, in CreateAPIKeyInput) (out CreateAPIKeyOutput, err error) {
+	defer func() { a.record(ctx, AuditAPIKeyCreate, accountID, "key_id="+out.APIKey.ID, err) }()
+	if err := a.requireAdmin(ctx); err != nil {
+		return CreateAPIKeyOutput{}, err
+	}
+
+	key, k, err := a.accounts.CreateAPIKey(accountID, in)
+	if err != nil {
+		return CreateAPIKeyOutput{}, err
+	}
+	k.Hash = ""
+	return CreateAPIKeyOutput{Key: key, APIKey: k}, nil
+}
+
+type CreateAPIKeyOutput struct {
+	// Key is the only copy of the secret.
+	Key    string `json:"key"`
+	APIKey APIKey `json:"api_key"`
+}
+
+func (o CreateAPIKeyOutput) EncodeJSON() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+// ListAPIKeys returns the API keys of accountID, including revoked and expired ones.
+func (a AccountApplication) ListAPIKeys(ctx context.Context, accountID string) (ListAPIKeysOutput, error) {
+	if err := a.requireAdmin(ctx); err != nil {
+		return ListAPIKeysOutput{}, err
+	}
+
+	keys, err := a.accounts.APIKeys(accountID)
+	if err != nil {
+		return ListAPIKeysOutput{}, err
+	}
+	return ListAPIKeysOutput{APIKeys: keys}, nil
+}
+
+type ListAPIKeysOutput struct {
+	APIKeys []APIKey `json:"api_keys"`
+}
+
+func (o ListAPIKeysOutput) EncodeJSON() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+// RevokeAPIKey revokes an API key of accountID.
+func (a AccountApplication) RevokeAPIKey(ctx context.Context, accountID, keyID string) (err error) {
+	defer func() { a.record(ctx, AuditAPIKeyRevoke, accountID, "key_id="+keyID, err) }()
+	if err := a.requireAdmin(ctx); err != nil {
+		return err
+	}
+	return a.accounts.RevokeAPIKey(accountID, keyID)
+}
+
+// SetQuota sets the quota of accountID. Nil resets it to the default quota.
+func (a AccountApplication) SetQuota(ctx context.Context, accountID string, quota *Quota) (err error) {
+	defer func() { a.record(ctx, AuditAccountQuota, accountID, fmt.Sprintf("quota=%+v", quota), err) }()
+	if err := a.requireAdmin(ctx); err != nil {
+		return err
+	}
+	return a.accounts.SetQuota(accountID, quota)
+}
+
+// requireAdmin ...
+func (a AccountApplication) requireAdmin(ctx context.Context) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	if a.accounts == nil {
+		return fmt.Errorf("no account store")
+	}
+	return nil
+}
+
+// record records an audit event of the caller in ctx on accountID.
+func (a AccountApplication) record(ctx context.Context, typ, accountID, detail string, err error) {
+	e := NewAuditEvent(ctx, typ, err)
+	e.Owner = accountID
+	if err == nil {
+		e.Detail = detail
+	}
+	a.audit.Record(e)
+}
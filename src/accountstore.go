@@ -0,0 +1,381 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrUnauthenticated is returned when credentials do not match an account.
+	ErrUnauthenticated = errors.New("authentication failed")
+	// ErrAccountNotFound ...
+	ErrAccountNotFound = errors.New("account is not found")
+	// ErrAccountExists ...
+	ErrAccountExists = errors.New("account already exists")
+)
+
+const (
+	// AccountsFileName is the name of the account store file in the data directory.
+	AccountsFileName = "accounts.json"
+	// MaxAccountIDLength is bounded by the account ID field of the TCP handshake.
+	MaxAccountIDLength = 32
+	// MinPasswordLength ...
+	MinPasswordLength = 8
+	// MaxPasswordLength is bounded by the password field of the TCP handshake.
+	MaxPasswordLength = 64
+)
+
+// Account ...
+type Account struct {
+	ID string `json:"id"`
+	// PasswordHash is the bcrypt hash of the password, which embeds its salt and cost.
+	PasswordHash string `json:"password_hash"`
+	// Roles are granted permissions by grants to roles.
+	Roles   []string `json:"roles,omitempty"`
+	APIKeys []APIKey `json:"api_keys,omitempty"`
+	// Quota overrides the default quota when set.
+	Quota     *Quota    `json:"quota,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// storedAccount is an account as stored in the file, which may hold the
+// API tokens of earlier versions.
+type storedAccount struct {
+	Account
+	// Tokens are API tokens, which are API keys without scope and expiry
+	// in the same format.
+	Tokens []APIKey `json:"tokens,omitempty"`
+}
+
+// migrate returns the account with its tokens as unscoped API keys. They
+// are saved as API keys on the next change of the store.
+func (a storedAccount) migrate() Account {
+	account := a.Account
+	for _, t := range a.Tokens {
+		if !hasAPIKey(account.APIKeys, t.ID) {
+			account.APIKeys = append(account.APIKeys, APIKey{ID: t.ID, Name: t.Name, Hash: t.Hash, CreatedAt: t.CreatedAt})
+		}
+	}
+	return account
+}
+
+// hasAPIKey ...
+func hasAPIKey(keys []APIKey, id string) bool {
+	for _, k := range keys {
+		if k.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// AccountStore is the set of accounts persisted as a JSON file. The file is
+// reloaded when it is changed by another process, e.g. the user subcommands.
+type AccountStore struct {
+	path string
+	cost int
+
+	mu       sync.Mutex
+	accounts map[string]Account
+	modTime  time.Time
+	size     int64
+	// quotaCheckedAt is when quota last reloaded the file.
+	quotaCheckedAt time.Time
+
+	dummyOnce sync.Once
+	dummy     []byte
+}
+
+// NewAccountStore loads the account store at path. A missing file is an empty store.
+func NewAccountStore(path string) (*AccountStore, error) {
+	s := &AccountStore{
+		path:     path,
+		cost:     bcrypt.DefaultCost,
+		accounts: make(map[string]Account),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Authenticate returns the account when password matches its hash.
+func (s *AccountStore) Authenticate(accountID, password string) (Account, error) {
+	s.mu.Lock()
+	if err := s.reload(); err != nil {
+		log.Printf("account store: %v\n", err)
+	}
+	account, ok := s.accounts[accountID]
+	s.mu.Unlock()
+
+	hash := []byte(account.PasswordHash)
+	if !ok {
+		// compare against a dummy hash so that unknown accounts take as
+		// long as wrong passwords
+		hash = s.dummyHash()
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !ok {
+		return Account{}, ErrUnauthenticated
+	}
+	return account, nil
+}
+
+// Get returns an account, for callers authenticated by other means than
+// its password.
+func (s *AccountStore) Get(accountID string) (Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return Account{}, err
+	}
+
+	account, ok := s.accounts[accountID]
+	if !ok {
+		return Account{}, fmt.Errorf("%w: account ID \"%s\"", ErrAccountNotFound, accountID)
+	}
+	return account, nil
+}
+
+// Len returns the number of accounts.
+func (s *AccountStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		log.Printf("account store: %v\n", err)
+	}
+	return len(s.accounts)
+}
+
+// List returns the accounts sorted by ID.
+func (s *AccountStore) List() ([]Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	accounts := make([]Account, 0, len(s.accounts))
+	for _, a := range s.accounts {
+		accounts = append(accounts, a)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	return accounts, nil
+}
+
+// Add creates an account with the password.
+func (s *AccountStore) Add(accountID, password string) error {
+	if err := ValidateAccountID(accountID); err != nil {
+		return err
+	}
+	hash, err := s.hash(password)
+	if err != nil {
+		return err
+	}
+
+	return s.update(func(accounts map[string]Account) error {
+		if _, ok := accounts[accountID]; ok {
+			return fmt.Errorf("%w: account ID \"%s\"", ErrAccountExists, accountID)
+		}
+		now := time.Now()
+		accounts[accountID] = Account{
+			ID:           accountID,
+			PasswordHash: hash,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		return nil
+	})
+}
+
+// Remove deletes an account.
+func (s *AccountStore) Remove(accountID string) error {
+	return s.update(func(accounts map[string]Account) error {
+		if _, ok := accounts[accountID]; !ok {
+			return fmt.Errorf("%w: account ID \"%s\"", ErrAccountNotFound, accountID)
+		}
+		delete(accounts, accountID)
+		return nil
+	})
+}
+
+// SetPassword replaces the password of an account.
+func (s *AccountStore) SetPassword(accountID, password string) error {
+	hash, err := s.hash(password)
+	if err != nil {
+		return err
+	}
+
+	return s.update(func(accounts map[string]Account) error {
+		account, ok := accounts[accountID]
+		if !ok {
+			return fmt.Errorf("%w: account ID \"%s\"", ErrAccountNotFound, accountID)
+		}
+		account.PasswordHash = hash
+		account.UpdatedAt = time.Now()
+		accounts[accountID] = account
+		return nil
+	})
+}
+
+// SetRoles replaces the roles of an account.
+func (s *AccountStore) SetRoles(accountID string, roles []string) error {
+	for _, r := range roles {
+		if err := ValidateRole(r); err != nil {
+			return err
+		}
+	}
+
+	return s.update(func(accounts map[string]Account) error {
+		account, ok := accounts[accountID]
+		if !ok {
+			return fmt.Errorf("%w: account ID \"%s\"", ErrAccountNotFound, accountID)
+		}
+		account.Roles = roles
+		account.UpdatedAt = time.Now()
+		accounts[accountID] = account
+		return nil
+	})
+}
+
+// update applies f to the latest accounts and saves them.
+func (s *AccountStore) update(f func(accounts map[string]Account) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	accounts := make(map[string]Account, len(s.accounts))
+	for id, a := range s.accounts {
+		accounts[id] = a
+	}
+	if err := f(accounts); err != nil {
+		return err
+	}
+	if err := s.save(accounts); err != nil {
+		return err
+	}
+	s.accounts = accounts
+	return nil
+}
+
+// reload reads the file when it has changed since the last read. s.mu must be held.
+func (s *AccountStore) reload() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.accounts, s.modTime, s.size = make(map[string]Account), time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var list []storedAccount
+	if err := json.Unmarshal(b, &list); err != nil {
+		return fmt.Errorf("invalid account store %s: %v", s.path, err)
+	}
+	accounts := make(map[string]Account, len(list))
+	for _, a := range list {
+		accounts[a.ID] = a.migrate()
+	}
+	s.accounts, s.modTime, s.size = accounts, info.ModTime(), info.Size()
+	return nil
+}
+
+// save replaces the file atomically. s.mu must be held.
+func (s *AccountStore) save(accounts map[string]Account) error {
+	list := make([]Account, 0, len(accounts))
+	for _, a := range accounts {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, AccountsFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.modTime, s.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// hash ...
+func (s *AccountStore) hash(password string) (string, error) {
+	if err := ValidatePassword(password); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// dummyHash ...
+func (s *AccountStore) dummyHash() []byte {
+	s.dummyOnce.Do(func() {
+		s.dummy, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), s.cost)
+	})
+	return s.dummy
+}
+
+// ValidateAccountID checks the account ID grammar, which is the one of queue
+// names up to MaxAccountIDLength characters.
+func ValidateAccountID(accountID string) error {
+	return validateName("account ID", accountID, MaxAccountIDLength)
+}
+
+// ValidatePassword ...
+func ValidatePassword(password string) error {
+	if n := utf8.RuneCountInString(password); n < MinPasswordLength || n > MaxPasswordLength {
+		return fmt.Errorf("%w: password must be %d to %d characters", ErrInvalidArgument, MinPasswordLength, MaxPasswordLength)
+	}
+	// bcrypt only uses the first 72 bytes
+	if len(password) > 72 {
+		return fmt.Errorf("%w: password must be at most 72 bytes", ErrInvalidArgument)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package src
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAccountStore_Authenticate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), AccountsFileName)
+	s, err := NewAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cost = bcrypt.MinCost
+	if err := s.Add("alice", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	// another process, e.g. the user subcommands, changes the password
+	cli, err := NewAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.cost = bcrypt.MinCost
+	if err := cli.SetPassword("alice", "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Add("alice", "battery staple"); !errors.Is(err, ErrAccountExists) {
+		t.Errorf("Add() error = %v, want ErrAccountExists", err)
+	}
+
+	tests := []struct {
+		name      string
+		accountID string
+		password  string
+		wantErr   bool
+	}{
+		{name: "changed password", accountID: "alice", password: "battery staple", wantErr: false},
+		{name: "old password", accountID: "alice", password: "correct horse", wantErr: true},
+		{name: "unknown account", accountID: "bob", password: "battery staple", wantErr: true},
+		{name: "empty", accountID: "", password: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Authenticate(tt.accountID, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUnauthenticated) {
+				t.Errorf("Authenticate() error = %v, want ErrUnauthenticated", err)
+			}
+			if err == nil && got.ID != tt.accountID {
+				t.Errorf("Authenticate() = %v, want %v", got.ID, tt.accountID)
+			}
+		})
+	}
+}
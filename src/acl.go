@@ -0,0 +1,132 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Permission is an operation another account can be granted on queues.
+type Permission string
+
+const (
+	// PermissionPublish allows publishing messages.
+	PermissionPublish Permission = "publish"
+	// PermissionConsume allows consuming and nacking messages.
+	PermissionConsume Permission = "consume"
+	// PermissionDelete allows deleting consumed messages.
+	PermissionDelete Permission = "delete"
+	// PermissionManage allows reading and changing attributes, tags and pause state.
+	PermissionManage Permission = "manage"
+)
+
+// validate ...
+func (p Permission) validate() error {
+	switch p {
+	case PermissionPublish, PermissionConsume, PermissionDelete, PermissionManage:
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown permission \"%s\"", ErrInvalidArgument, p)
+	}
+}
+
+const (
+	// GranteeAccountPrefix prefixes grantees naming an account.
+	GranteeAccountPrefix = "account:"
+	// GranteeRolePrefix prefixes grantees naming a role of accounts.
+	GranteeRolePrefix = "role:"
+)
+
+// Grant gives a grantee permissions on the queues of an owner matching a
+// name pattern. Owners and admins always have every permission.
+type Grant struct {
+	// Grantee is "account:<account ID>" or "role:<role>".
+	Grantee string `json:"grantee"`
+	// Queue is a queue name pattern where * matches any characters and ? one.
+	Queue       string       `json:"queue"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// DecodeGrant ...
+func DecodeGrant(b []byte) (Grant, error) {
+	var g Grant
+	if err := json.Unmarshal(b, &g); err != nil {
+		return Grant{}, fmt.Errorf("%w: invalid grant: %v", ErrInvalidArgument, err)
+	}
+	return g, g.Validate()
+}
+
+// Validate ...
+func (g Grant) Validate() error {
+	if err := validateGrantee(g.Grantee); err != nil {
+		return err
+	}
+	if err := validateQueuePattern(g.Queue); err != nil {
+		return err
+	}
+	if len(g.Permissions) == 0 {
+		return fmt.Errorf("%w: grant has no permissions", ErrInvalidArgument)
+	}
+	for _, p := range g.Permissions {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allows reports whether g gives p the permission perm on the queue name.
+func (g Grant) allows(p Principal, name string, perm Permission) bool {
+	if !g.matchesGrantee(p) {
+		return false
+	}
+	if ok, _ := path.Match(g.Queue, name); !ok {
+		return false
+	}
+	for _, granted := range g.Permissions {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesGrantee ...
+func (g Grant) matchesGrantee(p Principal) bool {
+	if accountID, ok := strings.CutPrefix(g.Grantee, GranteeAccountPrefix); ok {
+		return accountID == p.AccountID
+	}
+	if role, ok := strings.CutPrefix(g.Grantee, GranteeRolePrefix); ok {
+		for _, r := range p.Roles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateGrantee ...
+func validateGrantee(grantee string) error {
+	if accountID, ok := strings.CutPrefix(grantee, GranteeAccountPrefix); ok {
+		return ValidateAccountID(accountID)
+	}
+	if role, ok := strings.CutPrefix(grantee, GranteeRolePrefix); ok {
+		return ValidateRole(role)
+	}
+	return fmt.Errorf("%w: grantee must be %s<account ID> or %s<role>", ErrInvalidArgument, GranteeAccountPrefix, GranteeRolePrefix)
+}
+
+// validateQueuePattern checks that pattern is a queue name with wildcards.
+func validateQueuePattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("%w: queue pattern \"%s\": %v", ErrInvalidArgument, pattern, err)
+	}
+	return validateName("queue pattern", strings.NewReplacer("*", "_", "?", "_").Replace(pattern), MaxQueueNameLength)
+}
+
+// ValidateRole checks the role grammar, which is the one of queue names.
+func ValidateRole(role string) error {
+	return validateName("role", role, MaxQueueNameLength)
+}
@@ -0,0 +1,83 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMessageQueueApplication_authorize(t *testing.T) {
+	m := NewMQManager(MQManagerConfig{})
+	producer := Owner{AccountID: "producer"}
+	for _, name := range []string{"orders-eu", "payments"} {
+		if err := m.CreateQueue(producer, name, QueueAttributes{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	grants := []Grant{
+		{Grantee: "account:consumer", Queue: "orders-*", Permissions: []Permission{PermissionConsume, PermissionDelete}},
+		{Grantee: "role:auditor", Queue: "*", Permissions: []Permission{PermissionManage}},
+	}
+	for _, g := range grants {
+		if err := m.Grant(producer, g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := NewMessageQueueApplication(m, nil)
+
+	tests := []struct {
+		name      string
+		principal Principal
+		queue     string
+		perm      Permission
+		wantErr   bool
+	}{
+		{name: "owner", principal: Principal{AccountID: "producer"}, queue: "payments", perm: PermissionPublish},
+		{name: "admin", principal: Principal{AccountID: "root", Admin: true}, queue: "payments", perm: PermissionPublish},
+		{name: "granted account", principal: Principal{AccountID: "consumer"}, queue: "orders-eu", perm: PermissionConsume},
+		{name: "not granted permission", principal: Principal{AccountID: "consumer"}, queue: "orders-eu", perm: PermissionPublish, wantErr: true},
+		{name: "not matching queue", principal: Principal{AccountID: "consumer"}, queue: "payments", perm: PermissionConsume, wantErr: true},
+		{name: "granted role", principal: Principal{AccountID: "bob", Roles: []string{"auditor"}}, queue: "payments", perm: PermissionManage},
+		{name: "stranger", principal: Principal{AccountID: "bob"}, queue: "payments", perm: PermissionManage, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithPrincipal(context.Background(), tt.principal)
+			err := app.authorize(ctx, "producer", tt.queue, tt.perm)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("authorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrForbidden) {
+				t.Errorf("authorize() error = %v, want ErrForbidden", err)
+			}
+		})
+	}
+
+	// grants are scoped to the namespace of the owner
+	ctx := WithNamespace(WithPrincipal(context.Background(), Principal{AccountID: "consumer"}), "staging")
+	if err := app.authorize(ctx, "producer", "orders-eu", PermissionConsume); !errors.Is(err, ErrForbidden) {
+		t.Errorf("authorize() in another namespace error = %v, want ErrForbidden", err)
+	}
+}
+
+func TestGrant_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		grant   Grant
+		wantErr bool
+	}{
+		{name: "account", grant: Grant{Grantee: "account:billing", Queue: "orders-*", Permissions: []Permission{PermissionPublish}}},
+		{name: "role", grant: Grant{Grantee: "role:ops", Queue: "orders-??", Permissions: []Permission{PermissionManage}}},
+		{name: "unknown grantee kind", grant: Grant{Grantee: "billing", Queue: "*", Permissions: []Permission{PermissionPublish}}, wantErr: true},
+		{name: "invalid pattern", grant: Grant{Grantee: "role:ops", Queue: "orders/*", Permissions: []Permission{PermissionPublish}}, wantErr: true},
+		{name: "unknown permission", grant: Grant{Grantee: "role:ops", Queue: "*", Permissions: []Permission{"purge"}}, wantErr: true},
+		{name: "no permissions", grant: Grant{Grantee: "role:ops", Queue: "*"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.grant.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package src
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/verniyyy/verniy-mq/src/util"
+)
+
+// ErrAPIKeyNotFound ...
+var ErrAPIKeyNotFound = errors.New("API key is not found")
+
+// apiKeyPrefix starts every key, followed by the key ID and the secret
+// separated by underscores.
+const apiKeyPrefix = "vmq"
+
+// APIKey is a credential of an account for programs, optionally limited to
+// a scope and a lifetime. Only the hash of its secret is stored, the key
+// itself is shown once when it is created.
+type APIKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Hash is the hex SHA-256 of the secret. Secrets are random so a slow
+	// hash is not needed.
+	Hash string `json:"hash,omitempty"`
+	// Scope limits what the key can do. A nil scope allows what the account can.
+	Scope *APIKeyScope `json:"scope,omitempty"`
+	// ExpiresAt is when the key stops working. Nil never expires.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Revoked   bool       `json:"revoked,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// usable reports whether the key is neither revoked nor expired at now.
+func (k APIKey) usable(now time.Time) bool {
+	return !k.Revoked && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// APIKeyScope limits the operations of an API key.
+type APIKeyScope struct {
+	// Permissions are the operations allowed. Empty allows all of them.
+	Permissions []Permission `json:"permissions,omitempty"`
+	// Queues are the queue name patterns the key works on, with * and ?
+	// wildcards. Empty allows every queue.
+	Queues []string `json:"queues,omitempty"`
+}
+
+// Validate ...
+func (s *APIKeyScope) Validate() error {
+	if s == nil {
+		return nil
+	}
+	for _, p := range s.Permissions {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	for _, q := range s.Queues {
+		if err := validateQueuePattern(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allows reports whether s allows perm on the queue name. Operations on no
+// particular queue pass an empty name, which only a pattern matching every
+// name allows. A nil scope allows everything.
+func (s *APIKeyScope) allows(name string, perm Permission) bool {
+	if s == nil {
+		return true
+	}
+
+	permitted := len(s.Permissions) == 0
+	for _, p := range s.Permissions {
+		if p == perm {
+			permitted = true
+			break
+		}
+	}
+	if !permitted {
+		return false
+	}
+
+	if len(s.Queues) == 0 {
+		return true
+	}
+	for _, pattern := range s.Queues {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateAPIKeyInput struct {
+	Name  string       `json:"name,omitempty"`
+	Scope *APIKeyScope `json:"scope,omitempty"`
+	// ExpiresIn is the lifetime of the key. Zero never expires.
+	ExpiresIn util.Duration `json:"expires_in,omitempty"`
+}
+
+// DecodeCreateAPIKeyInput ...
+func DecodeCreateAPIKeyInput(b []byte) (CreateAPIKeyInput, error) {
+	var in CreateAPIKeyInput
+	if len(b) == 0 {
+		return in, nil
+	}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return CreateAPIKeyInput{}, fmt.Errorf("%w: invalid API key input: %v", ErrInvalidArgument, err)
+	}
+	return in, nil
+}
+
+// validate ...
+func (in CreateAPIKeyInput) validate() error {
+	if in.ExpiresIn < 0 {
+		return fmt.Errorf("%w: expires_in must not be negative", ErrInvalidArgument)
+	}
+	return in.Scope.Validate()
+}
+
+// CreateAPIKey issues an API key for an account. The returned key is the
+// only copy of its secret.
+func (s *AccountStore) CreateAPIKey(accountID string, in CreateAPIKeyInput) (string, APIKey, error) {
+	if err := in.validate(); err != nil {
+		return "", APIKey{}, err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", APIKey{}, err
+	}
+	secret := hex.EncodeToString(b)
+	now := time.Now()
+	k := APIKey{
+		ID:        util.GenULID(),
+		Name:      in.Name,
+		Hash:      hashSecret(secret),
+		Scope:     in.Scope,
+		CreatedAt: now,
+	}
+	if in.ExpiresIn > 0 {
+		expiresAt := now.Add(in.ExpiresIn.Std())
+		k.ExpiresAt = &expiresAt
+	}
+
+	err := s.update(func(accounts map[string]Account) error {
+		account, ok := accounts[accountID]
+		if !ok {
+			return fmt.Errorf("%w: account ID \"%s\"", ErrAccountNotFound, accountID)
+		}
+		// the full slice expression copies the keys shared with s.accounts
+		account.APIKeys = append(account.APIKeys[:len(account.APIKeys):len(account.APIKeys)], k)
+		accounts[accountID] = account
+		return nil
+	})
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	return strings.Join([]string{apiKeyPrefix, k.ID, secret}, "_"), k, nil
+}
+
+// RevokeAPIKey marks an API key of an account revoked. Revoked keys are
+// kept so that they can be audited.
+func (s *AccountStore) RevokeAPIKey(accountID, keyID string) error {
+	return s.update(func(accounts map[string]Account) error {
+		account, ok := accounts[accountID]
+		if !ok {
+			return fmt.Errorf("%w: account ID \"%s\"", ErrAccountNotFound, accountID)
+		}
+		keys := append([]APIKey{}, account.APIKeys...)
+		for i, k := range keys {
+			if k.ID != keyID {
+				continue
+			}
+			if !k.Revoked {
+				now := time.Now()
+				keys[i].Revoked, keys[i].RevokedAt = true, &now
+			}
+			account.APIKeys = keys
+			accounts[accountID] = account
+			return nil
+		}
+		return fmt.Errorf("%w: key ID \"%s\"", ErrAPIKeyNotFound, keyID)
+	})
+}
+
+// APIKeys returns the API keys of an account without their hashes.
+func (s *AccountStore) APIKeys(accountID string) ([]APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	account, ok := s.accounts[accountID]
+	if !ok {
+		return nil, fmt.Errorf("%w: account ID \"%s\"", ErrAccountNotFound, accountID)
+	}
+	keys := make([]APIKey, len(account.APIKeys))
+	for i, k := range account.APIKeys {
+		k.Hash = ""
+		keys[i] = k
+	}
+	return keys, nil
+}
+
+// AuthenticateAPIKey returns the account and the key which key is.
+func (s *AccountStore) AuthenticateAPIKey(key string) (Account, APIKey, error) {
+	id, secret, ok := parseAPIKey(key)
+	if !ok {
+		return Account{}, APIKey{}, ErrUnauthenticated
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		log.Printf("account store: %v\n", err)
+	}
+	for _, account := range s.accounts {
+		for _, k := range account.APIKeys {
+			if k.ID != id {
+				continue
+			}
+			if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hashSecret(secret))) != 1 {
+				return Account{}, APIKey{}, ErrUnauthenticated
+			}
+			if !k.usable(time.Now()) {
+				return Account{}, APIKey{}, fmt.Errorf("%w: API key \"%s\" is revoked or expired", ErrUnauthenticated, k.ID)
+			}
+			return account, k, nil
+		}
+	}
+	return Account{}, APIKey{}, ErrUnauthenticated
+}
+
+// parseAPIKey splits a key into its ID and secret.
+func parseAPIKey(key string) (id, secret string, ok bool) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// hashSecret ...
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,132 @@
+package src
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/verniyyy/verniy-mq/src/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAccountStore_AuthenticateAPIKey(t *testing.T) {
+	s, err := NewAccountStore(filepath.Join(t.TempDir(), AccountsFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cost = bcrypt.MinCost
+	if err := s.Add("alice", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	key, _, err := s.CreateAPIKey("alice", CreateAPIKeyInput{Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := s.CreateAPIKey("alice", CreateAPIKeyInput{ExpiresIn: util.Duration(time.Nanosecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedKey, err := s.CreateAPIKey("alice", CreateAPIKeyInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeAPIKey("alice", revokedKey.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "valid", key: key, wantErr: false},
+		{name: "wrong secret", key: key + "0", wantErr: true},
+		{name: "malformed", key: "vmq_" + key, wantErr: true},
+		{name: "expired", key: expired, wantErr: true},
+		{name: "revoked", key: revoked, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account, _, err := s.AuthenticateAPIKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AuthenticateAPIKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUnauthenticated) {
+				t.Errorf("AuthenticateAPIKey() error = %v, want ErrUnauthenticated", err)
+			}
+			if err == nil && account.ID != "alice" {
+				t.Errorf("AuthenticateAPIKey() = %v, want alice", account.ID)
+			}
+		})
+	}
+}
+
+func TestAccountStore_legacyTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), AccountsFileName)
+	// an account store written by a version with API tokens
+	legacy := `[{"id": "alice", "password_hash": "x", "tokens": [
+		{"id": "01HTOKEN", "name": "ci", "hash": "` + hashSecret("secret") + `", "created_at": "2026-01-02T03:04:05Z"}
+	]}]`
+	if err := os.WriteFile(path, []byte(legacy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, key, err := s.AuthenticateAPIKey("vmq_01HTOKEN_secret")
+	if err != nil {
+		t.Fatalf("AuthenticateAPIKey() of a token error = %v", err)
+	}
+	if account.ID != "alice" || key.Name != "ci" || key.Scope != nil || key.ExpiresAt != nil {
+		t.Errorf("AuthenticateAPIKey() of a token = %v %+v, want an unscoped key of alice", account.ID, key)
+	}
+
+	// tokens are saved as API keys on the next change and can be revoked
+	if err := s.RevokeAPIKey("alice", "01HTOKEN"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), `"tokens"`) {
+		t.Errorf("saved store still has tokens: %s", b)
+	}
+	if _, _, err := s.AuthenticateAPIKey("vmq_01HTOKEN_secret"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("AuthenticateAPIKey() of a revoked token error = %v, want ErrUnauthenticated", err)
+	}
+}
+
+func TestAPIKeyScope_allows(t *testing.T) {
+	scope := &APIKeyScope{
+		Permissions: []Permission{PermissionPublish},
+		Queues:      []string{"orders-*"},
+	}
+	tests := []struct {
+		name  string
+		scope *APIKeyScope
+		queue string
+		perm  Permission
+		want  bool
+	}{
+		{name: "in scope", scope: scope, queue: "orders-eu", perm: PermissionPublish, want: true},
+		{name: "other permission", scope: scope, queue: "orders-eu", perm: PermissionConsume, want: false},
+		{name: "other queue", scope: scope, queue: "payments", perm: PermissionPublish, want: false},
+		{name: "every queue", scope: scope, queue: "", perm: PermissionPublish, want: false},
+		{name: "any queue pattern", scope: &APIKeyScope{Queues: []string{"*"}}, queue: "", perm: PermissionManage, want: true},
+		{name: "no scope", scope: nil, queue: "payments", perm: PermissionManage, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scope.allows(tt.queue, tt.perm); got != tt.want {
+				t.Errorf("allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
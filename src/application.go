@@ -2,7 +2,12 @@ package src
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/verniyyy/verniy-mq/src/util"
 )
@@ -10,81 +15,731 @@ import (
 // MessageQueueApplication ...
 type MessageQueueApplication struct {
 	mqManager MQManager
+	audit     *AuditLog
 }
 
-// NewMessageQueueApplication ...
-func NewMessageQueueApplication(mqm MQManager) MessageQueueApplication {
+// NewMessageQueueApplication returns the application recording its
+// administrative operations to audit, which may be nil.
+func NewMessageQueueApplication(mqm MQManager, audit *AuditLog) MessageQueueApplication {
 	return MessageQueueApplication{
 		mqManager: mqm,
+		audit:     audit,
 	}
 }
 
 // CreateQueue ...
-func (a MessageQueueApplication) CreateQueue(ctx context.Context, userID, name string) error {
-	return a.mqManager.CreateQueue(userID, name)
+func (a MessageQueueApplication) CreateQueue(ctx context.Context, userID, name string, attrs QueueAttributes) (err error) {
+	defer func() { a.record(ctx, AuditQueueCreate, userID, name, "", err) }()
+	if err := a.requireOwner(ctx, userID, name); err != nil {
+		return err
+	}
+	return a.mqManager.CreateQueue(a.owner(ctx, userID), name, attrs)
 }
 
-// ListQueues ...
-func (a MessageQueueApplication) ListQueues(ctx context.Context, userID string) (ListQueuesOutput, error) {
-	mqList, err := a.mqManager.ListQueues(userID)
+// ListQueues lists the queues of userID matching the prefix a page at a time.
+func (a MessageQueueApplication) ListQueues(ctx context.Context, userID string, in ListQueuesInput) (ListQueuesOutput, error) {
+	if err := a.requireOwner(ctx, userID, ""); err != nil {
+		return ListQueuesOutput{}, err
+	}
+
+	if err := in.validate(); err != nil {
+		return ListQueuesOutput{}, err
+	}
+	maxResults := in.MaxResults
+	if maxResults == 0 {
+		maxResults = maxListQueuesResults
+	}
+	after, err := decodeNextToken(in.NextToken)
 	if err != nil {
 		return ListQueuesOutput{}, err
 	}
+	sel, err := ParseTagSelector(in.TagSelector)
+	if err != nil {
+		return ListQueuesOutput{}, err
+	}
+
+	mqList, err := a.mqManager.ListQueuesByTags(a.owner(ctx, userID), sel)
+	if err != nil {
+		return ListQueuesOutput{}, err
+	}
+	if in.Order == SortDesc {
+		for i, j := 0, len(mqList)-1; i < j; i, j = i+1, j-1 {
+			mqList[i], mqList[j] = mqList[j], mqList[i]
+		}
+	}
 
 	out := ListQueuesOutput{
-		Queues: make([]string, len(mqList)),
+		Queues: make([]string, 0, len(mqList)),
 	}
-	for i, q := range mqList {
-		out.Queues[i] = q.Name()
+	if in.IncludeStats {
+		out.Stats = make(map[string]QueueStats)
+	}
+	for _, q := range mqList {
+		name := q.Name()
+		if !strings.HasPrefix(name, in.Prefix) {
+			continue
+		}
+		if after != "" && ((in.Order == SortDesc && name >= after) || (in.Order != SortDesc && name <= after)) {
+			continue
+		}
+		if len(out.Queues) == maxResults {
+			out.NextToken = encodeNextToken(out.Queues[len(out.Queues)-1])
+			break
+		}
+
+		out.Queues = append(out.Queues, name)
+		if in.IncludeStats {
+			out.Stats[name] = q.Stats()
+		}
 	}
 
 	return out, nil
 }
 
+const maxListQueuesResults = 1000
+
+// SortOrder ...
+type SortOrder string
+
+const (
+	SortAsc  SortOrder = "asc"
+	SortDesc SortOrder = "desc"
+)
+
+type ListQueuesInput struct {
+	// Prefix filters queues by the beginning of the name.
+	Prefix string `json:"prefix,omitempty"`
+	// Order sorts queues by name. Defaults to asc.
+	Order SortOrder `json:"order,omitempty"`
+	// MaxResults is the page size up to 1000. Defaults to 1000.
+	MaxResults int `json:"max_results,omitempty"`
+	// NextToken continues from the page which returned it. The order
+	// must be the same as for that page.
+	NextToken string `json:"next_token,omitempty"`
+	// TagSelector filters queues by tags, e.g. "team=payments,env=prod".
+	TagSelector string `json:"tag_selector,omitempty"`
+	// IncludeStats adds the statistics of each queue.
+	IncludeStats bool `json:"include_stats,omitempty"`
+}
+
+// DecodeListQueuesInput ...
+func DecodeListQueuesInput(b []byte) (ListQueuesInput, error) {
+	var in ListQueuesInput
+	if len(b) == 0 {
+		return in, nil
+	}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return ListQueuesInput{}, fmt.Errorf("%w: invalid list input: %v", ErrInvalidArgument, err)
+	}
+	return in, nil
+}
+
+// validate ...
+func (in ListQueuesInput) validate() error {
+	switch in.Order {
+	case "", SortAsc, SortDesc:
+	default:
+		return fmt.Errorf("%w: invalid order: \"%s\"", ErrInvalidArgument, in.Order)
+	}
+	if in.MaxResults < 0 || in.MaxResults > maxListQueuesResults {
+		return fmt.Errorf("%w: max_results must be between 1 and %d", ErrInvalidArgument, maxListQueuesResults)
+	}
+	return nil
+}
+
+// encodeNextToken ...
+func encodeNextToken(lastName string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(lastName))
+}
+
+// decodeNextToken returns the last queue name of the previous page.
+func decodeNextToken(token string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid next_token", ErrInvalidArgument)
+	}
+	return string(b), nil
+}
+
 type ListQueuesOutput struct {
-	Queues []string `json:"queues"`
+	Queues    []string              `json:"queues"`
+	Stats     map[string]QueueStats `json:"stats,omitempty"`
+	NextToken string                `json:"next_token,omitempty"`
 }
 
 func (o ListQueuesOutput) EncodeJSON() ([]byte, error) {
 	return json.Marshal(o)
 }
 
+// GetQueueAttributes ...
+func (a MessageQueueApplication) GetQueueAttributes(ctx context.Context, userID, name string) (GetQueueAttributesOutput, error) {
+	if err := a.authorize(ctx, userID, name, PermissionManage); err != nil {
+		return GetQueueAttributesOutput{}, err
+	}
+
+	mq, err := a.mqManager.GetQueue(a.owner(ctx, userID), name)
+	if err != nil {
+		return GetQueueAttributesOutput{}, err
+	}
+	mq.Touch()
+	tags, err := a.mqManager.QueueTags(a.owner(ctx, userID), name)
+	if err != nil {
+		return GetQueueAttributesOutput{}, err
+	}
+
+	return GetQueueAttributesOutput{
+		Name:       mq.Name(),
+		Attributes: mq.Attributes(),
+		Tags:       tags,
+		Stats:      mq.Stats(),
+	}, nil
+}
+
+type GetQueueAttributesOutput struct {
+	Name       string            `json:"name"`
+	Attributes QueueAttributes   `json:"attributes"`
+	Tags       map[string]string `json:"tags"`
+	Stats      QueueStats        `json:"stats"`
+}
+
+func (o GetQueueAttributesOutput) EncodeJSON() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+// SetQueueAttributes updates the attributes of a live queue. patch is a
+// JSON object whose fields replace the current ones; zero resets a field
+// to the default. Fields left out or null keep their values, except that
+// null removes the dead_letter, retry and rate_limit policies.
+func (a MessageQueueApplication) SetQueueAttributes(ctx context.Context, userID, name string, patch []byte) error {
+	if err := a.authorize(ctx, userID, name, PermissionManage); err != nil {
+		return err
+	}
+	return a.mqManager.UpdateQueueAttributes(a.owner(ctx, userID), name, func(attrs *QueueAttributes) error {
+		if err := json.Unmarshal(patch, attrs); err != nil {
+			return fmt.Errorf("%w: invalid queue attributes: %v", ErrInvalidArgument, err)
+		}
+		return nil
+	})
+}
+
+// PauseQueue pauses publish and/or consume on a queue.
+func (a MessageQueueApplication) PauseQueue(ctx context.Context, userID, name string, in PauseQueueInput) error {
+	if err := a.authorize(ctx, userID, name, PermissionManage); err != nil {
+		return err
+	}
+	return a.setPaused(a.owner(ctx, userID), name, in, true)
+}
+
+// ResumeQueue resumes publish and/or consume on a queue.
+func (a MessageQueueApplication) ResumeQueue(ctx context.Context, userID, name string, in PauseQueueInput) error {
+	if err := a.authorize(ctx, userID, name, PermissionManage); err != nil {
+		return err
+	}
+	return a.setPaused(a.owner(ctx, userID), name, in, false)
+}
+
+// setPaused ...
+func (a MessageQueueApplication) setPaused(owner Owner, name string, in PauseQueueInput, paused bool) error {
+	if !in.Publish && !in.Consume {
+		return fmt.Errorf("%w: either publish or consume must be selected", ErrInvalidArgument)
+	}
+
+	return a.mqManager.UpdateQueueAttributes(owner, name, func(attrs *QueueAttributes) error {
+		if in.Publish {
+			attrs.PublishPaused = paused
+		}
+		if in.Consume {
+			attrs.ConsumePaused = paused
+		}
+		return nil
+	})
+}
+
+// PauseQueueInput selects the operations to pause or resume.
+type PauseQueueInput struct {
+	Publish bool `json:"publish"`
+	Consume bool `json:"consume"`
+}
+
+// DecodePauseQueueInput ...
+func DecodePauseQueueInput(b []byte) (PauseQueueInput, error) {
+	var in PauseQueueInput
+	if err := json.Unmarshal(b, &in); err != nil {
+		return PauseQueueInput{}, fmt.Errorf("%w: invalid pause input: %v", ErrInvalidArgument, err)
+	}
+	return in, nil
+}
+
 // DeleteQueue ...
-func (a MessageQueueApplication) DeleteQueue(ctx context.Context, userID, name string) error {
-	return a.mqManager.DeleteQueue(userID, name)
+func (a MessageQueueApplication) DeleteQueue(ctx context.Context, userID, name string) (err error) {
+	defer func() { a.record(ctx, AuditQueueDelete, userID, name, "", err) }()
+	if err := a.requireOwner(ctx, userID, name); err != nil {
+		return err
+	}
+	return a.mqManager.DeleteQueue(a.owner(ctx, userID), name)
 }
 
-// Publish ...
-func (a MessageQueueApplication) Publish(ctx context.Context, userID, name string, data []byte) error {
-	m, err := NewMessage(util.GenULID, data)
+// TagQueue adds tags to a queue.
+func (a MessageQueueApplication) TagQueue(ctx context.Context, userID, name string, tags map[string]string) error {
+	if err := a.authorize(ctx, userID, name, PermissionManage); err != nil {
+		return err
+	}
+
+	if err := a.mqManager.TagQueue(a.owner(ctx, userID), name, tags); err != nil {
+		return err
+	}
+	a.touch(a.owner(ctx, userID), name)
+	return nil
+}
+
+// UntagQueue removes tags from a queue.
+func (a MessageQueueApplication) UntagQueue(ctx context.Context, userID, name string, keys []string) error {
+	if err := a.authorize(ctx, userID, name, PermissionManage); err != nil {
+		return err
+	}
+
+	if err := a.mqManager.UntagQueue(a.owner(ctx, userID), name, keys); err != nil {
+		return err
+	}
+	a.touch(a.owner(ctx, userID), name)
+	return nil
+}
+
+// ListQueueTags ...
+func (a MessageQueueApplication) ListQueueTags(ctx context.Context, userID, name string) (ListQueueTagsOutput, error) {
+	if err := a.authorize(ctx, userID, name, PermissionManage); err != nil {
+		return ListQueueTagsOutput{}, err
+	}
+
+	tags, err := a.mqManager.QueueTags(a.owner(ctx, userID), name)
 	if err != nil {
+		return ListQueueTagsOutput{}, err
+	}
+	return ListQueueTagsOutput{Tags: tags}, nil
+}
+
+type ListQueueTagsOutput struct {
+	Tags map[string]string `json:"tags"`
+}
+
+func (o ListQueueTagsOutput) EncodeJSON() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+// DecodeTags decodes a JSON object of tags.
+func DecodeTags(b []byte) (map[string]string, error) {
+	var tags map[string]string
+	if err := json.Unmarshal(b, &tags); err != nil {
+		return nil, fmt.Errorf("%w: invalid tags: %v", ErrInvalidArgument, err)
+	}
+	return tags, nil
+}
+
+// DecodeTagKeys decodes a JSON array of tag keys.
+func DecodeTagKeys(b []byte) ([]string, error) {
+	var keys []string
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("%w: invalid tag keys: %v", ErrInvalidArgument, err)
+	}
+	return keys, nil
+}
+
+// AccountInfo returns the quota and the usage of userID.
+func (a MessageQueueApplication) AccountInfo(ctx context.Context, userID string) (AccountInfoOutput, error) {
+	if err := a.requireOwner(ctx, userID, ""); err != nil {
+		return AccountInfoOutput{}, err
+	}
+	return AccountInfoOutput{
+		AccountID: userID,
+		Quota:     a.mqManager.Quota(userID),
+		Usage:     a.mqManager.Usage(userID),
+	}, nil
+}
+
+// AccountInfoOutput is the quota of an account and what it holds.
+type AccountInfoOutput struct {
+	AccountID string     `json:"account_id"`
+	Quota     Quota      `json:"quota"`
+	Usage     QuotaUsage `json:"usage"`
+}
+
+func (o AccountInfoOutput) EncodeJSON() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+// checkPublishQuota checks the quota of the account owning the queue for a
+// message of size, taking storedSize once stored. Concurrent publishes may
+// go over it by a few messages.
+func (a MessageQueueApplication) checkPublishQuota(accountID string, size, storedSize int64) error {
+	q := a.mqManager.Quota(accountID)
+	if q == (Quota{}) {
+		return nil
+	}
+	var usage QuotaUsage
+	if q.MaxMessages > 0 || q.MaxBytes > 0 {
+		usage = a.mqManager.Usage(accountID)
+	}
+	return q.checkPublish(accountID, usage, size, storedSize)
+}
+
+// record records an audit event of the caller in ctx on the queues of userID.
+func (a MessageQueueApplication) record(ctx context.Context, typ, userID, queue, detail string, err error) {
+	e := NewAuditEvent(ctx, typ, err)
+	e.Owner, e.Queue = a.owner(ctx, userID).String(), queue
+	if err == nil {
+		e.Detail = detail
+	}
+	a.audit.Record(e)
+}
+
+// owner returns the owner of queues addressed by userID in the namespace
+// carried by ctx.
+func (a MessageQueueApplication) owner(ctx context.Context, userID string) Owner {
+	return Owner{AccountID: userID, Namespace: NamespaceFromContext(ctx)}
+}
+
+// requireOwner checks that the caller is userID or an admin. name is the
+// queue the operation works on, or empty for operations on every queue,
+// which the scope of the caller must allow managing.
+func (a MessageQueueApplication) requireOwner(ctx context.Context, userID, name string) error {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok || (!p.Admin && p.AccountID != userID) {
+		return fmt.Errorf("%w: only account \"%s\" can do this", ErrForbidden, userID)
+	}
+	if !p.Scope.allows(name, PermissionManage) {
+		return fmt.Errorf("%w: out of the scope of the credentials", ErrForbidden)
+	}
+	return nil
+}
+
+// authorize checks that the caller is userID, an admin, or is granted perm
+// on the queue name by userID, within the scope of the caller.
+func (a MessageQueueApplication) authorize(ctx context.Context, userID, name string, perm Permission) error {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok || !(p.Admin || p.AccountID == userID || a.mqManager.Allowed(a.owner(ctx, userID), name, p, perm)) {
+		return fmt.Errorf("%w: no %s permission on queue \"%s\" of account \"%s\"", ErrForbidden, perm, name, userID)
+	}
+	if !p.Scope.allows(name, perm) {
+		return fmt.Errorf("%w: %s on queue \"%s\" is out of the scope of the credentials", ErrForbidden, perm, name)
+	}
+	return nil
+}
+
+// GrantAccess adds a grant to the access control list of userID.
+func (a MessageQueueApplication) GrantAccess(ctx context.Context, userID string, g Grant) (err error) {
+	defer func() {
+		a.record(ctx, AuditACLGrant, userID, g.Queue, fmt.Sprintf("grantee=%s permissions=%v", g.Grantee, g.Permissions), err)
+	}()
+	if err := a.requireOwner(ctx, userID, ""); err != nil {
 		return err
 	}
+	return a.mqManager.Grant(a.owner(ctx, userID), g)
+}
+
+// RevokeAccess removes the grant for grantee and queue pattern from the access control list of userID.
+func (a MessageQueueApplication) RevokeAccess(ctx context.Context, userID, grantee, queue string) (err error) {
+	defer func() { a.record(ctx, AuditACLRevoke, userID, queue, "grantee="+grantee, err) }()
+	if err := a.requireOwner(ctx, userID, ""); err != nil {
+		return err
+	}
+	return a.mqManager.Revoke(a.owner(ctx, userID), grantee, queue)
+}
+
+// ListGrants returns the access control list of userID.
+func (a MessageQueueApplication) ListGrants(ctx context.Context, userID string) (ListGrantsOutput, error) {
+	if err := a.requireOwner(ctx, userID, ""); err != nil {
+		return ListGrantsOutput{}, err
+	}
+	return ListGrantsOutput{Grants: a.mqManager.Grants(a.owner(ctx, userID))}, nil
+}
+
+type ListGrantsOutput struct {
+	Grants []Grant `json:"grants"`
+}
+
+func (o ListGrantsOutput) EncodeJSON() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+type RevokeAccessInput struct {
+	Grantee string `json:"grantee"`
+	Queue   string `json:"queue"`
+}
+
+// DecodeRevokeAccessInput ...
+func DecodeRevokeAccessInput(b []byte) (RevokeAccessInput, error) {
+	var in RevokeAccessInput
+	if err := json.Unmarshal(b, &in); err != nil {
+		return RevokeAccessInput{}, fmt.Errorf("%w: invalid revoke input: %v", ErrInvalidArgument, err)
+	}
+	return in, nil
+}
+
+// touch records management activity on a queue.
+func (a MessageQueueApplication) touch(owner Owner, name string) {
+	if mq, err := a.mqManager.GetQueue(owner, name); err == nil {
+		mq.Touch()
+	}
+}
+
+// PurgeQueues purges every queue matching the tag selector. Only admins can purge.
+func (a MessageQueueApplication) PurgeQueues(ctx context.Context, userID, selector string) (out BulkQueuesOutput, err error) {
+	defer func() {
+		a.record(ctx, AuditQueuePurge, userID, selector, fmt.Sprintf("queues=%v purged=%d", out.Queues, out.Purged), err)
+	}()
+	if err := requireAdmin(ctx); err != nil {
+		return BulkQueuesOutput{}, err
+	}
+	mqList, err := a.selectQueues(a.owner(ctx, userID), selector)
+	if err != nil {
+		return BulkQueuesOutput{}, err
+	}
+
+	out = BulkQueuesOutput{Queues: make([]string, 0, len(mqList))}
+	for _, mq := range mqList {
+		out.Queues = append(out.Queues, mq.Name())
+		out.Purged += mq.Purge()
+	}
+	return out, nil
+}
+
+// DeleteQueues deletes every queue matching the tag selector.
+func (a MessageQueueApplication) DeleteQueues(ctx context.Context, userID, selector string) (out BulkQueuesOutput, err error) {
+	defer func() { a.record(ctx, AuditQueueDelete, userID, selector, fmt.Sprintf("queues=%v", out.Queues), err) }()
+	if err := a.requireOwner(ctx, userID, ""); err != nil {
+		return BulkQueuesOutput{}, err
+	}
+
+	mqList, err := a.selectQueues(a.owner(ctx, userID), selector)
+	if err != nil {
+		return BulkQueuesOutput{}, err
+	}
+
+	out = BulkQueuesOutput{Queues: make([]string, 0, len(mqList))}
+	for _, mq := range mqList {
+		name := mq.Name()
+		if err := a.mqManager.DeleteQueue(a.owner(ctx, userID), name); err != nil {
+			if errors.Is(err, ErrQueueNotFound) {
+				continue
+			}
+			return out, err
+		}
+		out.Queues = append(out.Queues, name)
+	}
+	return out, nil
+}
 
-	mq, err := a.mqManager.GetQueue(userID, name)
+// selectQueues lists the queues matching a selector which must not be empty.
+func (a MessageQueueApplication) selectQueues(owner Owner, selector string) ([]MessageQueue, error) {
+	sel, err := ParseTagSelector(selector)
 	if err != nil {
+		return nil, err
+	}
+	if sel.Empty() {
+		return nil, fmt.Errorf("%w: tag selector is required", ErrInvalidArgument)
+	}
+	return a.mqManager.ListQueuesByTags(owner, sel)
+}
+
+type BulkQueuesOutput struct {
+	Queues []string `json:"queues"`
+	Purged int64    `json:"purged,omitempty"`
+}
+
+func (o BulkQueuesOutput) EncodeJSON() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+// RenameQueue ...
+func (a MessageQueueApplication) RenameQueue(ctx context.Context, userID, name, newName string) error {
+	if err := a.requireOwner(ctx, userID, name); err != nil {
 		return err
 	}
 
-	return mq.Publish(m)
+	if newName == "" {
+		return fmt.Errorf("%w: new queue name is required", ErrInvalidArgument)
+	}
+	// the new name must be in the scope of the caller as well
+	if err := a.requireOwner(ctx, userID, newName); err != nil {
+		return err
+	}
+	return a.mqManager.RenameQueue(a.owner(ctx, userID), name, newName)
+}
+
+// TransferQueue hands a queue to another account.
+func (a MessageQueueApplication) TransferQueue(ctx context.Context, userID, name, newUserID string) (err error) {
+	defer func() { a.record(ctx, AuditQueueTransfer, userID, name, "new_account="+newUserID, err) }()
+	if err := a.requireOwner(ctx, userID, name); err != nil {
+		return err
+	}
+
+	if newUserID == "" {
+		return fmt.Errorf("%w: new account ID is required", ErrInvalidArgument)
+	}
+	return a.mqManager.TransferQueue(a.owner(ctx, userID), name, newUserID)
+}
+
+// Publish publishes data and returns the ID of the message.
+func (a MessageQueueApplication) Publish(ctx context.Context, userID, name string, data []byte) (string, error) {
+	if err := a.authorize(ctx, userID, name, PermissionPublish); err != nil {
+		return "", err
+	}
+
+	m, err := NewMessage(util.GenULID, data)
+	if err != nil {
+		return "", err
+	}
+
+	mq, err := a.mqManager.GetQueue(a.owner(ctx, userID), name)
+	if err != nil {
+		return "", err
+	}
+
+	// the quota counts the message as stored, so it is compressed first
+	if *m, err = compressMessage(mq.Attributes().Compression, *m); err != nil {
+		return "", err
+	}
+	if err := a.checkPublishQuota(userID, int64(len(data)), int64(len(m.Data))); err != nil {
+		return "", err
+	}
+
+	if err := a.mqManager.Throttle(userID, mq, PermissionPublish); err != nil {
+		return "", err
+	}
+
+	if err := mq.Publish(m); err != nil {
+		return "", err
+	}
+	return m.ID, nil
 }
 
 // Consume ...
 func (a MessageQueueApplication) Consume(ctx context.Context, userID, name string) (*Message, error) {
-	mq, err := a.mqManager.GetQueue(userID, name)
+	if err := a.authorize(ctx, userID, name, PermissionConsume); err != nil {
+		return nil, err
+	}
+
+	mq, err := a.mqManager.GetQueue(a.owner(ctx, userID), name)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := a.mqManager.Throttle(userID, mq, PermissionConsume); err != nil {
+		return nil, err
+	}
+
 	return mq.Consume()
 }
 
 // Delete ...
 func (a MessageQueueApplication) Delete(ctx context.Context, userID, name, messageID string) error {
-	mq, err := a.mqManager.GetQueue(userID, name)
+	if err := a.authorize(ctx, userID, name, PermissionDelete); err != nil {
+		return err
+	}
+
+	mq, err := a.mqManager.GetQueue(a.owner(ctx, userID), name)
 	if err != nil {
 		return err
 	}
 
 	return mq.Delete(messageID)
 }
+
+// Nack returns a consumed message to the queue immediately or after delay.
+func (a MessageQueueApplication) Nack(ctx context.Context, userID, name, messageID string, delay time.Duration, incrementReceiveCount bool) error {
+	if err := a.authorize(ctx, userID, name, PermissionConsume); err != nil {
+		return err
+	}
+
+	if delay < 0 {
+		return fmt.Errorf("%w: delay must not be negative", ErrInvalidArgument)
+	}
+
+	mq, err := a.mqManager.GetQueue(a.owner(ctx, userID), name)
+	if err != nil {
+		return err
+	}
+
+	return mq.Nack(messageID, delay, incrementReceiveCount)
+}
+
+// PurgeQueue removes every message of the queue. Only admins can purge.
+func (a MessageQueueApplication) PurgeQueue(ctx context.Context, userID, name string) (out PurgeQueueOutput, err error) {
+	defer func() { a.record(ctx, AuditQueuePurge, userID, name, fmt.Sprintf("purged=%d", out.Purged), err) }()
+	if err := requireAdmin(ctx); err != nil {
+		return PurgeQueueOutput{}, err
+	}
+
+	mq, err := a.mqManager.GetQueue(a.owner(ctx, userID), name)
+	if err != nil {
+		return PurgeQueueOutput{}, err
+	}
+
+	return PurgeQueueOutput{Purged: mq.Purge()}, nil
+}
+
+type PurgeQueueOutput struct {
+	Purged int64 `json:"purged"`
+}
+
+func (o PurgeQueueOutput) EncodeJSON() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+// BrowseQueue pages through messages without consuming them. Only admins can browse.
+func (a MessageQueueApplication) BrowseQueue(ctx context.Context, userID, name string, in BrowseQueueInput) (BrowseQueueOutput, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return BrowseQueueOutput{}, err
+	}
+	if in.Offset < 0 {
+		return BrowseQueueOutput{}, fmt.Errorf("%w: offset must not be negative", ErrInvalidArgument)
+	}
+	if in.Limit <= 0 || in.Limit > maxBrowseLimit {
+		in.Limit = maxBrowseLimit
+	}
+
+	mq, err := a.mqManager.GetQueue(a.owner(ctx, userID), name)
+	if err != nil {
+		return BrowseQueueOutput{}, err
+	}
+
+	messages, more := mq.Browse(in.Offset, in.Limit, in.IncludeInFlight)
+	out := BrowseQueueOutput{
+		Messages: messages,
+	}
+	if more {
+		next := in.Offset + len(messages)
+		out.NextOffset = &next
+	}
+
+	return out, nil
+}
+
+const maxBrowseLimit = 100
+
+type BrowseQueueInput struct {
+	Offset          int  `json:"offset"`
+	Limit           int  `json:"limit"`
+	IncludeInFlight bool `json:"include_in_flight"`
+}
+
+// DecodeBrowseQueueInput ...
+func DecodeBrowseQueueInput(b []byte) (BrowseQueueInput, error) {
+	var in BrowseQueueInput
+	if len(b) == 0 {
+		return in, nil
+	}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return BrowseQueueInput{}, fmt.Errorf("%w: invalid browse input: %v", ErrInvalidArgument, err)
+	}
+	return in, nil
+}
+
+type BrowseQueueOutput struct {
+	Messages   []MessageInfo `json:"messages"`
+	NextOffset *int          `json:"next_offset,omitempty"`
+}
+
+func (o BrowseQueueOutput) EncodeJSON() ([]byte, error) {
+	return json.Marshal(o)
+}
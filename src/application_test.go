@@ -0,0 +1,384 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/verniyyy/verniy-mq/src/util"
+)
+
+func TestMessageQueueApplication_PurgeQueue(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  Principal
+		userID     string
+		wantPurged int64
+		wantErr    error
+	}{
+		{name: "admin", principal: Principal{AccountID: "root", Admin: true}, userID: "producer", wantPurged: 3},
+		{name: "admin on a missing queue", principal: Principal{AccountID: "root", Admin: true}, userID: "bob", wantErr: ErrQueueNotFound},
+		{name: "owner", principal: Principal{AccountID: "producer"}, userID: "producer", wantErr: ErrForbidden},
+		{name: "stranger", principal: Principal{AccountID: "bob"}, userID: "producer", wantErr: ErrForbidden},
+		{name: "no principal", userID: "producer", wantErr: ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t, "producer", "orders", 3)
+			ctx := WithPrincipal(context.Background(), tt.principal)
+
+			out, err := app.PurgeQueue(ctx, tt.userID, "orders")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PurgeQueue() error = %v, want %v", err, tt.wantErr)
+			}
+			if out.Purged != tt.wantPurged {
+				t.Errorf("PurgeQueue() purged = %v, want %v", out.Purged, tt.wantPurged)
+			}
+		})
+	}
+}
+
+func TestMessageQueueApplication_BrowseQueue(t *testing.T) {
+	app := newTestApplication(t, "producer", "orders", 5)
+	owner := WithPrincipal(context.Background(), Principal{AccountID: "producer"})
+	if _, err := app.Consume(owner, "producer", "orders"); err != nil {
+		t.Fatal(err)
+	}
+	admin := Principal{AccountID: "root", Admin: true}
+
+	tests := []struct {
+		name       string
+		principal  Principal
+		in         BrowseQueueInput
+		wantIDs    []string
+		wantNext   int
+		wantErr    error
+		wantStates []MessageState
+	}{
+		{name: "first page", principal: admin, in: BrowseQueueInput{Limit: 2}, wantIDs: []string{"m1", "m2"}, wantNext: 2},
+		{name: "last page", principal: admin, in: BrowseQueueInput{Offset: 2, Limit: 2}, wantIDs: []string{"m3", "m4"}},
+		{
+			name:       "in flight",
+			principal:  admin,
+			in:         BrowseQueueInput{Offset: 3, IncludeInFlight: true},
+			wantIDs:    []string{"m4", "m0"},
+			wantStates: []MessageState{MessageReady, MessageInFlight},
+		},
+		{name: "owner", principal: Principal{AccountID: "producer"}, in: BrowseQueueInput{}, wantErr: ErrForbidden},
+		{name: "stranger", principal: Principal{AccountID: "bob"}, in: BrowseQueueInput{}, wantErr: ErrForbidden},
+		{name: "negative offset", principal: admin, in: BrowseQueueInput{Offset: -1}, wantErr: ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithPrincipal(context.Background(), tt.principal)
+			out, err := app.BrowseQueue(ctx, "producer", "orders", tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("BrowseQueue() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			var ids []string
+			for i, m := range out.Messages {
+				ids = append(ids, m.ID)
+				if tt.wantStates != nil && m.State != tt.wantStates[i] {
+					t.Errorf("message %s state = %v, want %v", m.ID, m.State, tt.wantStates[i])
+				}
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("BrowseQueue() ids = %v, want %v", ids, tt.wantIDs)
+			}
+			next := 0
+			if out.NextOffset != nil {
+				next = *out.NextOffset
+			}
+			if next != tt.wantNext {
+				t.Errorf("BrowseQueue() next offset = %v, want %v", next, tt.wantNext)
+			}
+		})
+	}
+
+	// browsing leaves the messages in the queue
+	mq, _ := app.mqManager.GetQueue(Owner{AccountID: "producer"}, "orders")
+	if got := mq.Stats().Messages; got != 4 {
+		t.Errorf("messages = %v, want 4", got)
+	}
+}
+
+// newTestApplication returns an application with the queue name of
+// accountID holding n messages with IDs m0, m1, ...
+func newTestApplication(t *testing.T, accountID, name string, n int) MessageQueueApplication {
+	t.Helper()
+	m := NewMQManager(MQManagerConfig{})
+	if err := m.CreateQueue(Owner{AccountID: accountID}, name, QueueAttributes{}); err != nil {
+		t.Fatal(err)
+	}
+	mq, _ := m.GetQueue(Owner{AccountID: accountID}, name)
+	for i := 0; i < n; i++ {
+		if err := mq.Publish(&Message{ID: fmt.Sprintf("m%d", i), Data: []byte("data")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewMessageQueueApplication(m, nil)
+}
+
+func TestMessageQueueApplication_GetQueueAttributes(t *testing.T) {
+	before := time.Now()
+	m := NewMQManager(MQManagerConfig{})
+	owner := Owner{AccountID: "producer"}
+	if err := m.CreateQueue(owner, "orders", QueueAttributes{MaxLength: 10, MaxBytes: 100}); err != nil {
+		t.Fatal(err)
+	}
+	app := NewMessageQueueApplication(m, nil)
+	ctx := WithPrincipal(context.Background(), Principal{AccountID: "producer"})
+
+	mq, _ := m.GetQueue(owner, "orders")
+	for i, age := range []time.Duration{3 * time.Minute, 2 * time.Minute, time.Minute, 0} {
+		msg := &Message{ID: fmt.Sprintf("m%d", i), Data: []byte("0123456789"), SentAt: time.Now().Add(-age)}
+		if err := mq.Publish(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	consumed, err := app.Consume(ctx, "producer", "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.Consume(ctx, "producer", "orders"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delete(ctx, "producer", "orders", consumed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := app.GetQueueAttributes(ctx, "producer", "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := out.Stats
+	want := QueueStats{
+		Messages:         2,
+		Bytes:            20,
+		InFlightMessages: 1,
+		Published:        4,
+		Consumed:         2,
+		Deleted:          1,
+		MaxLength:        10,
+		MaxBytes:         100,
+		LengthUsage:      0.2,
+		BytesUsage:       0.2,
+	}
+	got := s
+	got.OldestMessageAge, got.CreatedAt, got.ModifiedAt = 0, time.Time{}, time.Time{}
+	if got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+	// m2 is at the front after m0 and m1 are consumed
+	if age := s.OldestMessageAge.Std(); age < time.Minute || age > 2*time.Minute {
+		t.Errorf("OldestMessageAge = %v, want about 1m", age)
+	}
+	if s.CreatedAt.Before(before) || !s.ModifiedAt.Equal(s.CreatedAt) {
+		t.Errorf("CreatedAt = %v, ModifiedAt = %v, want the creation time", s.CreatedAt, s.ModifiedAt)
+	}
+
+	if err := app.SetQueueAttributes(ctx, "producer", "orders", []byte(`{"max_length":20}`)); err != nil {
+		t.Fatal(err)
+	}
+	out, err = app.GetQueueAttributes(ctx, "producer", "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Stats.ModifiedAt.After(s.CreatedAt) || !out.Stats.CreatedAt.Equal(s.CreatedAt) {
+		t.Errorf("CreatedAt = %v, ModifiedAt = %v, want modified after creation", out.Stats.CreatedAt, out.Stats.ModifiedAt)
+	}
+	if out.Stats.LengthUsage != 0.1 {
+		t.Errorf("LengthUsage = %v, want 0.1", out.Stats.LengthUsage)
+	}
+}
+
+func TestMessageQueueApplication_SetQueueAttributes(t *testing.T) {
+	initial := QueueAttributes{
+		VisibilityTimeout: util.Duration(time.Minute),
+		MaxLength:         10,
+		Retry:             &RetryPolicy{Base: util.Duration(time.Second)},
+	}
+	tests := []struct {
+		name    string
+		patch   string
+		want    QueueAttributes
+		wantErr error
+	}{
+		{
+			name:  "replace",
+			patch: `{"visibility_timeout":"30s","delay":5}`,
+			want:  QueueAttributes{VisibilityTimeout: util.Duration(30 * time.Second), Delay: util.Duration(5 * time.Second), MaxLength: 10, Retry: initial.Retry},
+		},
+		{
+			name:  "zero resets",
+			patch: `{"visibility_timeout":0,"max_length":0}`,
+			want:  QueueAttributes{Retry: initial.Retry},
+		},
+		{
+			name:  "null keeps scalars and removes policies",
+			patch: `{"visibility_timeout":null,"max_length":null,"retry":null}`,
+			want:  QueueAttributes{VisibilityTimeout: initial.VisibilityTimeout, MaxLength: 10},
+		},
+		{name: "invalid", patch: `{"max_length":-1}`, want: initial, wantErr: ErrInvalidArgument},
+		{name: "malformed", patch: `{"delay":"soon"}`, want: initial, wantErr: ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMQManager(MQManagerConfig{})
+			if err := m.CreateQueue(Owner{AccountID: "producer"}, "orders", initial); err != nil {
+				t.Fatal(err)
+			}
+			app := NewMessageQueueApplication(m, nil)
+			ctx := WithPrincipal(context.Background(), Principal{AccountID: "producer"})
+
+			err := app.SetQueueAttributes(ctx, "producer", "orders", []byte(tt.patch))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetQueueAttributes() error = %v, want %v", err, tt.wantErr)
+			}
+			mq, _ := m.GetQueue(Owner{AccountID: "producer"}, "orders")
+			if got := mq.Attributes(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Attributes() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageQueueApplication_SetQueueAttributes_rejected(t *testing.T) {
+	attrs := func() QueueAttributes {
+		return QueueAttributes{
+			DeadLetter: &DeadLetterPolicy{Queue: "dlq", MaxReceiveCount: 3},
+			Retry:      &RetryPolicy{Base: util.Duration(time.Second), Multiplier: 2},
+			RateLimit:  &RateLimits{Publish: RateLimit{Rate: 100}},
+		}
+	}
+	m := NewMQManager(MQManagerConfig{})
+	owner := Owner{AccountID: "producer"}
+	for name, attrs := range map[string]QueueAttributes{"dlq": {}, "orders": attrs()} {
+		if err := m.CreateQueue(owner, name, attrs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := NewMessageQueueApplication(m, nil)
+	ctx := WithPrincipal(context.Background(), Principal{AccountID: "producer"})
+
+	// the policies are changed in place by the patch before it is rejected
+	for _, patch := range []string{
+		`{"rate_limit":{"publish":{"rate":-5}}}`,
+		`{"retry":{"multiplier":0.1}}`,
+		`{"dead_letter":{"queue":"missing"}}`,
+		`{"dead_letter":{"max_receive_count":1},"max_length":-1}`,
+	} {
+		if err := app.SetQueueAttributes(ctx, "producer", "orders", []byte(patch)); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("SetQueueAttributes(%s) error = %v, want ErrInvalidArgument", patch, err)
+		}
+	}
+	mq, _ := m.GetQueue(owner, "orders")
+	if got := mq.Attributes(); !reflect.DeepEqual(got, attrs()) {
+		t.Errorf("Attributes() = %+v, want %+v", got, attrs())
+	}
+	if _, err := app.Publish(ctx, "producer", "orders", []byte("data")); err != nil {
+		t.Errorf("Publish() error = %v", err)
+	}
+}
+
+func TestMessageQueueApplication_SetQueueAttributes_retention(t *testing.T) {
+	m := NewMQManager(MQManagerConfig{})
+	owner := Owner{AccountID: "producer"}
+	if err := m.CreateQueue(owner, "orders", QueueAttributes{}); err != nil {
+		t.Fatal(err)
+	}
+	mq, _ := m.GetQueue(owner, "orders")
+	now := time.Now()
+	for i, age := range []time.Duration{3 * time.Minute, 90 * time.Second, 0} {
+		if err := mq.Publish(&Message{ID: fmt.Sprintf("m%d", i), Data: []byte("data"), SentAt: now.Add(-age)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := NewMessageQueueApplication(m, nil)
+	ctx := WithPrincipal(context.Background(), Principal{AccountID: "producer"})
+
+	// a shorter retention period drops the older messages at once
+	if err := app.SetQueueAttributes(ctx, "producer", "orders", []byte(`{"retention_period":"2m"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if s := mq.Stats(); s.Messages != 2 || s.Bytes != 8 {
+		t.Errorf("Stats() messages = %v, bytes = %v, want 2 and 8", s.Messages, s.Bytes)
+	}
+	if n := mq.DropExpiredMessages(now.Add(time.Minute)); n != 1 {
+		t.Errorf("DropExpiredMessages() = %v, want 1", n)
+	}
+	got, err := app.Consume(ctx, "producer", "orders")
+	if err != nil || got.ID != "m2" {
+		t.Errorf("Consume() = %v, %v, want m2", got, err)
+	}
+}
+
+func TestMessageQueueApplication_ListQueues(t *testing.T) {
+	m := NewMQManager(MQManagerConfig{})
+	for _, name := range []string{"b1", "a2", "c", "a1", "a3"} {
+		if err := m.CreateQueue(Owner{AccountID: "producer"}, name, QueueAttributes{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := NewMessageQueueApplication(m, nil)
+	ctx := WithPrincipal(context.Background(), Principal{AccountID: "producer"})
+
+	tests := []struct {
+		name string
+		in   ListQueuesInput
+		// wantPages are the pages followed by next_token
+		wantPages [][]string
+		wantErr   error
+	}{
+		{name: "all", in: ListQueuesInput{}, wantPages: [][]string{{"a1", "a2", "a3", "b1", "c"}}},
+		{name: "desc", in: ListQueuesInput{Order: SortDesc}, wantPages: [][]string{{"c", "b1", "a3", "a2", "a1"}}},
+		{name: "prefix", in: ListQueuesInput{Prefix: "a"}, wantPages: [][]string{{"a1", "a2", "a3"}}},
+		{name: "no match", in: ListQueuesInput{Prefix: "x"}, wantPages: [][]string{{}}},
+		{name: "pages", in: ListQueuesInput{MaxResults: 2}, wantPages: [][]string{{"a1", "a2"}, {"a3", "b1"}, {"c"}}},
+		{name: "pages desc with prefix", in: ListQueuesInput{Order: SortDesc, Prefix: "a", MaxResults: 2}, wantPages: [][]string{{"a3", "a2"}, {"a1"}}},
+		{name: "exact page", in: ListQueuesInput{Prefix: "a", MaxResults: 3}, wantPages: [][]string{{"a1", "a2", "a3"}}},
+		{name: "max results bound", in: ListQueuesInput{MaxResults: maxListQueuesResults}, wantPages: [][]string{{"a1", "a2", "a3", "b1", "c"}}},
+		{name: "max results over bound", in: ListQueuesInput{MaxResults: maxListQueuesResults + 1}, wantErr: ErrInvalidArgument},
+		{name: "negative max results", in: ListQueuesInput{MaxResults: -1}, wantErr: ErrInvalidArgument},
+		{name: "invalid order", in: ListQueuesInput{Order: "random"}, wantErr: ErrInvalidArgument},
+		{name: "invalid next token", in: ListQueuesInput{NextToken: "!"}, wantErr: ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := tt.in
+			var pages [][]string
+			for {
+				out, err := app.ListQueues(ctx, "producer", in)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ListQueues() error = %v, want %v", err, tt.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				pages = append(pages, out.Queues)
+				if out.NextToken == "" {
+					break
+				}
+				if len(pages) > len(tt.wantPages) {
+					t.Fatalf("ListQueues() pages = %v, want %v", pages, tt.wantPages)
+				}
+				in.NextToken = out.NextToken
+			}
+			if fmt.Sprint(pages) != fmt.Sprint(tt.wantPages) {
+				t.Errorf("ListQueues() pages = %v, want %v", pages, tt.wantPages)
+			}
+		})
+	}
+
+	stranger := WithPrincipal(context.Background(), Principal{AccountID: "bob"})
+	if _, err := app.ListQueues(stranger, "producer", ListQueuesInput{}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("ListQueues() of a stranger error = %v, want ErrForbidden", err)
+	}
+}
@@ -0,0 +1,443 @@
+package src
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit event types.
+const (
+	AuditAuthSuccess   = "auth.success"
+	AuditAuthFailure   = "auth.failure"
+	AuditQueueCreate   = "queue.create"
+	AuditQueueDelete   = "queue.delete"
+	AuditQueuePurge    = "queue.purge"
+	AuditQueueTransfer = "queue.transfer"
+	AuditACLGrant      = "acl.grant"
+	AuditACLRevoke     = "acl.revoke"
+	AuditAPIKeyCreate  = "apikey.create"
+	AuditAPIKeyRevoke  = "apikey.revoke"
+	AuditAccountQuota  = "account.quota"
+	// account changes of the user subcommands
+	AuditAccountCreate   = "account.create"
+	AuditAccountDelete   = "account.delete"
+	AuditAccountPassword = "account.password"
+	AuditAccountRoles    = "account.roles"
+)
+
+// Audit event outcomes.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// ErrAuditChainBroken ...
+var ErrAuditChainBroken = errors.New("audit hash chain is broken")
+
+// AuditEvent is a line of the audit log. Hash is the hex SHA-256 of the
+// JSON of the event without it, which includes PrevHash, the hash of the
+// event before.
+type AuditEvent struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	// Account is the account which did the operation or tried to authenticate.
+	Account string `json:"account,omitempty"`
+	// Owner and Queue are the owner of the queues and the queue name, tag
+	// selector or grant pattern the operation was on.
+	Owner        string `json:"owner,omitempty"`
+	Queue        string `json:"queue,omitempty"`
+	RemoteAddr   string `json:"remote_addr,omitempty"`
+	ConnectionID string `json:"connection_id,omitempty"`
+	RequestID    string `json:"request_id,omitempty"`
+	Outcome      string `json:"outcome"`
+	Detail       string `json:"detail,omitempty"`
+	PrevHash     string `json:"prev_hash"`
+	Hash         string `json:"hash"`
+}
+
+// hash ...
+func (e AuditEvent) hash() (string, error) {
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditSource is where a request comes from.
+type AuditSource struct {
+	RemoteAddr   string
+	ConnectionID string
+	RequestID    string
+}
+
+// auditSourceKey ...
+type auditSourceKey struct{}
+
+// WithAuditSource ...
+func WithAuditSource(ctx context.Context, s AuditSource) context.Context {
+	return context.WithValue(ctx, auditSourceKey{}, s)
+}
+
+// AuditSourceFromContext ...
+func AuditSourceFromContext(ctx context.Context) AuditSource {
+	s, _ := ctx.Value(auditSourceKey{}).(AuditSource)
+	return s
+}
+
+// NewAuditEvent returns an event of the caller in ctx with the outcome of err.
+func NewAuditEvent(ctx context.Context, typ string, err error) AuditEvent {
+	s := AuditSourceFromContext(ctx)
+	e := AuditEvent{
+		Type:         typ,
+		RemoteAddr:   s.RemoteAddr,
+		ConnectionID: s.ConnectionID,
+		RequestID:    s.RequestID,
+		Outcome:      AuditSuccess,
+	}
+	if p, ok := PrincipalFromContext(ctx); ok {
+		e.Account = p.AccountID
+	}
+	if err != nil {
+		e.Outcome, e.Detail = AuditFailure, err.Error()
+	}
+	return e
+}
+
+// AuditLogConfig ...
+type AuditLogConfig struct {
+	Path string
+	// MaxSize is the size in bytes the log is rotated at. Zero never rotates.
+	MaxSize int64
+	// MaxBackups is the number of rotated files kept as Path.1 (the newest)
+	// to Path.N. Zero keeps them all.
+	MaxBackups int
+}
+
+// AuditLog writes hash chained audit events as JSON lines. The chain goes
+// on across rotated files. A nil *AuditLog records nothing.
+//
+// The server and the subcommands changing accounts can share a log: writers
+// take the lock file Path.lock and go on with the chain of the events the
+// others wrote.
+type AuditLog struct {
+	cfg AuditLogConfig
+
+	mu       sync.Mutex
+	lock     *os.File
+	file     *os.File
+	size     int64
+	seq      uint64
+	lastHash string
+}
+
+// OpenAuditLog opens the log for appending, going on with the chain of the
+// last event written.
+func OpenAuditLog(cfg AuditLogConfig) (*AuditLog, error) {
+	lock, err := os.OpenFile(cfg.Path+".lock", os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &AuditLog{cfg: cfg, lock: lock}
+	if err := l.reopen(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record appends an event, filling in its sequence number, time and hashes.
+// Failures are logged, auditing does not fail the operations.
+func (l *AuditLog) Record(e AuditEvent) {
+	if l == nil {
+		return
+	}
+	if err := l.record(e); err != nil {
+		log.Printf("audit log: %v\n", err)
+	}
+}
+
+// record ...
+func (l *AuditLog) record(e AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := lockFile(l.lock); err != nil {
+		return err
+	}
+	defer unlockFile(l.lock)
+	if err := l.sync(); err != nil {
+		return err
+	}
+
+	e.Seq, e.Time, e.PrevHash = l.seq+1, time.Now().UTC(), l.lastHash
+	hash, err := e.hash()
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	if l.cfg.MaxSize > 0 && l.size > 0 && l.size+int64(len(b)) > l.cfg.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(b)
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	l.seq, l.lastHash = e.Seq, e.Hash
+	return nil
+}
+
+// Close ...
+func (l *AuditLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lock.Close()
+	return l.file.Close()
+}
+
+// sync reopens the log when another writer has appended to it or rotated
+// it since l last wrote. l.mu and the lock file must be held.
+func (l *AuditLog) sync() error {
+	info, err := os.Stat(l.cfg.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil && info.Size() == l.size {
+		current, err := l.file.Stat()
+		if err != nil {
+			return err
+		}
+		if os.SameFile(info, current) {
+			return nil
+		}
+	}
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	return l.reopen()
+}
+
+// reopen opens the file of the log, going on with the chain of its last
+// event, which is in the newest file which is not empty.
+func (l *AuditLog) reopen() error {
+	l.seq, l.lastHash = 0, ""
+	for _, path := range []string{l.cfg.Path, l.cfg.Path + ".1"} {
+		last, ok, err := lastAuditEvent(path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			l.seq, l.lastHash = last.Seq, last.Hash
+			break
+		}
+	}
+	return l.open()
+}
+
+// open ...
+func (l *AuditLog) open() error {
+	f, err := os.OpenFile(l.cfg.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
+
+// rotate renames Path.N to Path.N+1, dropping the ones beyond MaxBackups,
+// and Path to Path.1. l.mu must be held.
+func (l *AuditLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	backups, err := auditBackups(l.cfg.Path)
+	if err != nil {
+		return err
+	}
+	for i := len(backups); i >= 1; i-- {
+		path := fmt.Sprintf("%s.%d", l.cfg.Path, i)
+		if l.cfg.MaxBackups > 0 && i >= l.cfg.MaxBackups {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.Rename(path, fmt.Sprintf("%s.%d", l.cfg.Path, i+1)); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(l.cfg.Path, l.cfg.Path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// AuditLogFiles returns the files of the log at path from the oldest to the newest.
+func AuditLogFiles(path string) ([]string, error) {
+	backups, err := auditBackups(path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(backups)+1)
+	for i := len(backups); i >= 1; i-- {
+		files = append(files, fmt.Sprintf("%s.%d", path, i))
+	}
+	return append(files, path), nil
+}
+
+// auditBackups returns the numbers of the rotated files of path, which
+// must be consecutive from 1.
+func auditBackups(path string) ([]int, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var backups []int
+	for _, m := range matches {
+		if n, err := strconv.Atoi(strings.TrimPrefix(m, path+".")); err == nil && n > 0 {
+			backups = append(backups, n)
+		}
+	}
+	sort.Ints(backups)
+	for i, n := range backups {
+		if n != i+1 {
+			return nil, fmt.Errorf("audit log %s.%d is missing", path, i+1)
+		}
+	}
+	return backups, nil
+}
+
+// AuditVerifyResult ...
+type AuditVerifyResult struct {
+	Events   uint64
+	FirstSeq uint64
+	LastSeq  uint64
+	// LastHash anchors the chain; keeping it elsewhere detects the log
+	// being rewritten as a whole.
+	LastHash string
+}
+
+// VerifyAuditLog checks the hash chain through files, from the oldest to
+// the newest. The first event may follow events of rotated files which
+// were dropped.
+func VerifyAuditLog(files []string) (AuditVerifyResult, error) {
+	var res AuditVerifyResult
+	for _, path := range files {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		err = func() error {
+			defer f.Close()
+			s := bufio.NewScanner(f)
+			s.Buffer(nil, maxAuditLineSize)
+			for line := 1; s.Scan(); line++ {
+				if err := res.verify(s.Bytes()); err != nil {
+					return fmt.Errorf("%s:%d: %w", path, line, err)
+				}
+			}
+			return s.Err()
+		}()
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// verify checks that line follows the events verified before.
+func (r *AuditVerifyResult) verify(line []byte) error {
+	var e AuditEvent
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&e); err != nil {
+		return fmt.Errorf("%w: %v", ErrAuditChainBroken, err)
+	}
+	hash, err := e.hash()
+	if err != nil {
+		return err
+	}
+	if hash != e.Hash {
+		return fmt.Errorf("%w: event %d does not match its hash", ErrAuditChainBroken, e.Seq)
+	}
+	if r.Events > 0 && (e.PrevHash != r.LastHash || e.Seq != r.LastSeq+1) {
+		return fmt.Errorf("%w: event %d does not follow event %d", ErrAuditChainBroken, e.Seq, r.LastSeq)
+	}
+	if r.Events == 0 {
+		r.FirstSeq = e.Seq
+	}
+	r.Events++
+	r.LastSeq, r.LastHash = e.Seq, e.Hash
+	return nil
+}
+
+// maxAuditLineSize ...
+const maxAuditLineSize = 1 << 20
+
+// lastAuditEvent reads the last event of the file at path.
+func lastAuditEvent(path string) (AuditEvent, bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return AuditEvent{}, false, nil
+	}
+	if err != nil {
+		return AuditEvent{}, false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return AuditEvent{}, false, err
+	}
+	// the last line is within the tail of the file
+	offset := max(info.Size()-maxAuditLineSize, 0)
+	b, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+	if err != nil {
+		return AuditEvent{}, false, err
+	}
+	b = bytes.TrimRight(b, "\n")
+	if len(b) == 0 {
+		return AuditEvent{}, false, nil
+	}
+	var e AuditEvent
+	if err := json.Unmarshal(b[bytes.LastIndexByte(b, '\n')+1:], &e); err != nil {
+		return AuditEvent{}, false, fmt.Errorf("%w: last event of %s: %v", ErrAuditChainBroken, path, err)
+	}
+	return e, true, nil
+}
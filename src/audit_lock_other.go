@@ -0,0 +1,16 @@
+//go:build !unix
+
+package src
+
+import "os"
+
+// lockFile does nothing where flock is not available, so only one process
+// should write an audit log there.
+func lockFile(*os.File) error {
+	return nil
+}
+
+// unlockFile ...
+func unlockFile(*os.File) error {
+	return nil
+}
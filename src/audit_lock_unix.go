@@ -0,0 +1,18 @@
+//go:build unix
+
+package src
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock of f shared with other processes.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+// unlockFile ...
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,132 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	cfg := AuditLogConfig{Path: path, MaxSize: 1024, MaxBackups: 3}
+	ctx := WithAuditSource(WithPrincipal(context.Background(), Principal{AccountID: "root"}), AuditSource{ConnectionID: "conn"})
+
+	l, err := OpenAuditLog(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		l.Record(NewAuditEvent(ctx, AuditQueueCreate, nil))
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopening goes on with the chain
+	l, err = OpenAuditLog(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		l.Record(NewAuditEvent(ctx, AuditAuthFailure, ErrUnauthenticated))
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := AuditLogFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != cfg.MaxBackups+1 {
+		t.Fatalf("AuditLogFiles() = %v, want %d files", files, cfg.MaxBackups+1)
+	}
+	res, err := VerifyAuditLog(files)
+	if err != nil {
+		t.Fatalf("VerifyAuditLog() error = %v", err)
+	}
+	if res.LastSeq != 20 || res.FirstSeq == 1 {
+		t.Errorf("VerifyAuditLog() = %+v, want the oldest events rotated out up to seq 20", res)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(b []byte) []byte
+	}{
+		{
+			name: "changed event",
+			tamper: func(b []byte) []byte {
+				return bytes.Replace(b, []byte(`"outcome":"failure"`), []byte(`"outcome":"success"`), 1)
+			},
+		},
+		{
+			name: "removed event",
+			tamper: func(b []byte) []byte {
+				i := bytes.IndexByte(b, '\n')
+				j := bytes.IndexByte(b[i+1:], '\n')
+				return append(b[:i+1:i+1], b[i+1+j+1:]...)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the chain goes on across the files
+			var b []byte
+			for _, f := range files {
+				content, err := os.ReadFile(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b = append(b, content...)
+			}
+			tampered := filepath.Join(t.TempDir(), "audit.log")
+			if err := os.WriteFile(tampered, tt.tamper(b), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := VerifyAuditLog([]string{tampered}); !errors.Is(err, ErrAuditChainBroken) {
+				t.Errorf("VerifyAuditLog() error = %v, want ErrAuditChainBroken", err)
+			}
+		})
+	}
+}
+
+func TestAuditLog_writers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	cfg := AuditLogConfig{Path: path, MaxSize: 1024}
+	ctx := WithPrincipal(context.Background(), Principal{AccountID: "root"})
+
+	// the server and a subcommand write the same log in turns
+	server, err := OpenAuditLog(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	for i := 0; i < 10; i++ {
+		server.Record(NewAuditEvent(ctx, AuditQueueCreate, nil))
+		cli, err := OpenAuditLog(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cli.Record(NewAuditEvent(context.Background(), AuditAccountCreate, nil))
+		cli.Record(NewAuditEvent(context.Background(), AuditAccountRoles, nil))
+		if err := cli.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server.Record(NewAuditEvent(ctx, AuditQueueDelete, nil))
+
+	files, err := AuditLogFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := VerifyAuditLog(files)
+	if err != nil {
+		t.Fatalf("VerifyAuditLog() error = %v", err)
+	}
+	if res.FirstSeq != 1 || res.LastSeq != 31 || res.Events != 31 {
+		t.Errorf("VerifyAuditLog() = %+v, want 31 events", res)
+	}
+}
@@ -0,0 +1,96 @@
+package src
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrCorruptData is returned when compressed data can not be decompressed.
+var ErrCorruptData = errors.New("corrupt compressed data")
+
+// Codec is a compression of message payloads.
+type Codec string
+
+const (
+	// CodecNone leaves payloads as they are. This is the default.
+	CodecNone Codec = ""
+	// CodecGzip ...
+	CodecGzip Codec = "gzip"
+	// CodecDeflate is raw deflate without the zlib or gzip framing.
+	CodecDeflate Codec = "deflate"
+)
+
+// validate ...
+func (c Codec) validate() error {
+	switch c {
+	case CodecNone, CodecGzip, CodecDeflate:
+		return nil
+	default:
+		return fmt.Errorf("invalid compression: \"%s\"", c)
+	}
+}
+
+// Encode compresses data.
+func (c Codec) Encode(data []byte) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch c {
+	case CodecNone:
+		return data, nil
+	case CodecGzip:
+		w = gzip.NewWriter(&buf)
+	case CodecDeflate:
+		// only fails on invalid levels
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	default:
+		return nil, c.validate()
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode decompresses data of up to limit bytes decompressed. Zero limit
+// is unlimited.
+func (c Codec) Decode(data []byte, limit int64) ([]byte, error) {
+	var r io.ReadCloser
+	switch c {
+	case CodecNone:
+		return data, nil
+	case CodecGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptData, err)
+		}
+		r = gr
+	case CodecDeflate:
+		r = flate.NewReader(bytes.NewReader(data))
+	default:
+		return nil, c.validate()
+	}
+	defer r.Close()
+
+	lr := io.Reader(r)
+	if limit > 0 {
+		lr = io.LimitReader(r, limit+1)
+	}
+	b, err := io.ReadAll(lr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptData, err)
+	}
+	if limit > 0 && int64(len(b)) > limit {
+		return nil, fmt.Errorf("%w: decompressed data is larger than %d bytes", ErrInvalidArgument, limit)
+	}
+	return b, nil
+}
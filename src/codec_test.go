@@ -0,0 +1,62 @@
+package src
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func Test_messageQueue_compression(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"item":"apple","count":1}`), 40)
+	tests := []struct {
+		name           string
+		codec          Codec
+		data           []byte
+		wantCompressed bool
+	}{
+		{name: "none", codec: CodecNone, data: data},
+		{name: "gzip", codec: CodecGzip, data: data, wantCompressed: true},
+		{name: "deflate", codec: CodecDeflate, data: data, wantCompressed: true},
+		{name: "incompressible", codec: CodecGzip, data: []byte("x")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mq := newMessageQueue("test", QueueAttributes{Compression: tt.codec})
+			if err := mq.Publish(&Message{ID: "1", Data: tt.data}); err != nil {
+				t.Fatal(err)
+			}
+			stored := mq.Stats().Bytes
+			if compressed := stored < int64(len(tt.data)); compressed != tt.wantCompressed {
+				t.Errorf("stored %d bytes of %d, want compressed %v", stored, len(tt.data), tt.wantCompressed)
+			}
+
+			infos, _ := mq.Browse(0, 10, false)
+			if len(infos) != 1 || !bytes.Equal(infos[0].Data, tt.data) {
+				t.Errorf("Browse() = %+v", infos)
+			}
+			m, err := mq.Consume()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(m.Data, tt.data) {
+				t.Errorf("Consume() data = %q, want %q", m.Data, tt.data)
+			}
+		})
+	}
+}
+
+func TestCodec_Decode_limit(t *testing.T) {
+	b, err := CodecDeflate.Encode(make([]byte, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CodecDeflate.Decode(b, 1000); err != nil {
+		t.Errorf("Decode() error = %v", err)
+	}
+	if _, err := CodecDeflate.Decode(b, 999); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Decode() error = %v, want ErrInvalidArgument", err)
+	}
+	if _, err := CodecGzip.Decode(b, 0); !errors.Is(err, ErrCorruptData) {
+		t.Errorf("Decode() error = %v, want ErrCorruptData", err)
+	}
+}
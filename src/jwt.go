@@ -0,0 +1,379 @@
+package src
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTConfig ...
+type JWTConfig struct {
+	// JWKSFile is the JSON Web Key Set the signatures are verified with. It
+	// is reloaded when it changes.
+	JWKSFile string
+	// Issuer and Audience are required to match the iss and aud claims when set.
+	Issuer   string
+	Audience string
+	// Leeway is the clock skew allowed on exp and nbf.
+	Leeway time.Duration
+
+	// AccountClaim names the claim holding the account ID.
+	AccountClaim string
+	// RolesClaim names the claim holding the roles, a list or a space
+	// separated string.
+	RolesClaim string
+	// PermissionsClaim and QueuesClaim name the claims holding the scope,
+	// lists or space separated strings. Tokens with neither are not scoped.
+	PermissionsClaim string
+	QueuesClaim      string
+
+	// AllowAdmin lets tokens without scope claims have the admin rights of
+	// their account. Otherwise they are limited to an empty scope, which
+	// allows what the account can but, as every scope, not admin rights, so
+	// that the identity provider can not mint admins.
+	AllowAdmin bool
+}
+
+// DefaultJWTConfig ...
+func DefaultJWTConfig() JWTConfig {
+	return JWTConfig{
+		Leeway:           1 * time.Minute,
+		AccountClaim:     "sub",
+		RolesClaim:       "roles",
+		PermissionsClaim: "vmq_permissions",
+		QueuesClaim:      "vmq_queues",
+	}
+}
+
+// JWTVerifier verifies JWTs signed with RS256, ES256 or HS256 and maps
+// their claims to an account.
+type JWTVerifier struct {
+	cfg JWTConfig
+
+	mu      sync.Mutex
+	keys    []jwk
+	modTime time.Time
+	size    int64
+}
+
+// NewJWTVerifier loads the key set of cfg.
+func NewJWTVerifier(cfg JWTConfig) (*JWTVerifier, error) {
+	v := &JWTVerifier{cfg: cfg}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.reload(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// LooksLikeJWT reports whether token has the three parts of a JWS compact
+// serialization, telling JWTs apart from API keys.
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Verify checks the signature and the registered claims of token and
+// returns the account and the scope its claims map to.
+func (v *JWTVerifier) Verify(token string) (Account, *APIKeyScope, error) {
+	account, scope, err := v.verify(token, time.Now())
+	if err != nil {
+		return Account{}, nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	return account, scope, nil
+}
+
+// verify ...
+func (v *JWTVerifier) verify(token string, now time.Time) (Account, *APIKeyScope, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Account{}, nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Account{}, nil, fmt.Errorf("invalid header: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Account{}, nil, fmt.Errorf("invalid signature: %v", err)
+	}
+
+	keys := v.currentKeys()
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range keys {
+		if header.Kid != "" && k.Kid != header.Kid {
+			continue
+		}
+		if k.verify(header.Alg, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return Account{}, nil, fmt.Errorf("no %s key with kid \"%s\" verifies the signature", header.Alg, header.Kid)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Account{}, nil, fmt.Errorf("invalid claims: %v", err)
+	}
+	if err := v.checkClaims(claims, now); err != nil {
+		return Account{}, nil, err
+	}
+	return v.mapClaims(claims)
+}
+
+// checkClaims checks the registered claims exp, nbf, iss and aud. exp is required.
+func (v *JWTVerifier) checkClaims(claims map[string]any, now time.Time) error {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("exp claim is required")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.cfg.Leeway)) {
+		return errors.New("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.cfg.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token is not valid yet")
+	}
+	if v.cfg.Issuer != "" && claims["iss"] != v.cfg.Issuer {
+		return fmt.Errorf("issuer \"%v\" is not accepted", claims["iss"])
+	}
+	if v.cfg.Audience != "" && !contains(claimStrings(claims["aud"]), v.cfg.Audience) {
+		return fmt.Errorf("audience \"%v\" is not accepted", claims["aud"])
+	}
+	return nil
+}
+
+// mapClaims ...
+func (v *JWTVerifier) mapClaims(claims map[string]any) (Account, *APIKeyScope, error) {
+	accountID, _ := claims[v.cfg.AccountClaim].(string)
+	if err := ValidateAccountID(accountID); err != nil {
+		return Account{}, nil, fmt.Errorf("%s claim: %v", v.cfg.AccountClaim, err)
+	}
+	account := Account{ID: accountID, Roles: claimStrings(claims[v.cfg.RolesClaim])}
+
+	permissions, hasPermissions := claims[v.cfg.PermissionsClaim]
+	queues, hasQueues := claims[v.cfg.QueuesClaim]
+	if !hasPermissions && !hasQueues {
+		if v.cfg.AllowAdmin {
+			return account, nil, nil
+		}
+		return account, &APIKeyScope{}, nil
+	}
+	scope := &APIKeyScope{Queues: claimStrings(queues)}
+	for _, p := range claimStrings(permissions) {
+		scope.Permissions = append(scope.Permissions, Permission(p))
+	}
+	if err := scope.Validate(); err != nil {
+		return Account{}, nil, err
+	}
+	return account, scope, nil
+}
+
+// currentKeys returns the keys, reloading the key set when it changed. The
+// keys loaded before are kept when reloading fails.
+func (v *JWTVerifier) currentKeys() []jwk {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.reload(); err != nil {
+		log.Printf("jwt: %v\n", err)
+	}
+	return v.keys
+}
+
+// reload reads the key set when it has changed since the last read. v.mu must be held.
+func (v *JWTVerifier) reload() error {
+	info, err := os.Stat(v.cfg.JWKSFile)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(v.modTime) && info.Size() == v.size {
+		return nil
+	}
+
+	b, err := os.ReadFile(v.cfg.JWKSFile)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return fmt.Errorf("invalid key set %s: %v", v.cfg.JWKSFile, err)
+	}
+	keys := make([]jwk, 0, len(set.Keys))
+	for i, raw := range set.Keys {
+		k, err := parseJWK(raw)
+		if err != nil {
+			return fmt.Errorf("invalid key set %s: key %d: %v", v.cfg.JWKSFile, i, err)
+		}
+		keys = append(keys, k)
+	}
+	v.keys, v.modTime, v.size = keys, info.ModTime(), info.Size()
+	return nil
+}
+
+// jwk is a verification key of a key set.
+type jwk struct {
+	Kid string
+	// Alg restricts the key to one algorithm when set.
+	Alg    string
+	rsa    *rsa.PublicKey
+	ecdsa  *ecdsa.PublicKey
+	secret []byte
+}
+
+// parseJWK supports RSA, EC P-256 and oct keys.
+func parseJWK(raw json.RawMessage) (jwk, error) {
+	var f struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+		K   string `json:"k"`
+	}
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return jwk{}, err
+	}
+	k := jwk{Kid: f.Kid, Alg: f.Alg}
+
+	switch f.Kty {
+	case "RSA":
+		n, err := decodeBigInt(f.N)
+		if err != nil {
+			return jwk{}, err
+		}
+		e, err := decodeBigInt(f.E)
+		if err != nil {
+			return jwk{}, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return jwk{}, errors.New("invalid RSA exponent")
+		}
+		k.rsa = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		if f.Crv != "P-256" {
+			return jwk{}, fmt.Errorf("unsupported curve \"%s\"", f.Crv)
+		}
+		x, err := decodeBigInt(f.X)
+		if err != nil {
+			return jwk{}, err
+		}
+		y, err := decodeBigInt(f.Y)
+		if err != nil {
+			return jwk{}, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return jwk{}, errors.New("point is not on the curve")
+		}
+		k.ecdsa = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(f.K)
+		if err != nil {
+			return jwk{}, err
+		}
+		if len(secret) < sha256.Size {
+			return jwk{}, errors.New("HMAC secret must be at least 32 bytes")
+		}
+		k.secret = secret
+	default:
+		return jwk{}, fmt.Errorf("unsupported key type \"%s\"", f.Kty)
+	}
+	return k, nil
+}
+
+// verify reports whether sig is the signature of signed with alg by k.
+// The key type must match alg so that public keys can not be used as HMAC secrets.
+func (k jwk) verify(alg string, signed, sig []byte) bool {
+	if k.Alg != "" && k.Alg != alg {
+		return false
+	}
+	digest := sha256.Sum256(signed)
+
+	switch {
+	case alg == "RS256" && k.rsa != nil:
+		return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, digest[:], sig) == nil
+	case alg == "ES256" && k.ecdsa != nil:
+		if len(sig) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k.ecdsa, digest[:], r, s)
+	case alg == "HS256" && k.secret != nil:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), sig)
+	default:
+		return false
+	}
+}
+
+// decodeSegment decodes a base64url JSON segment of a token.
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// decodeBigInt ...
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// claimStrings reads a claim which is a list of strings or a space separated string.
+func claimStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		s := make([]string, 0, len(v))
+		for _, e := range v {
+			if e, ok := e.(string); ok {
+				s = append(s, e)
+			}
+		}
+		return s
+	default:
+		return nil
+	}
+}
+
+// contains ...
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
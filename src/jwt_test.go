@@ -0,0 +1,207 @@
+package src
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJWTVerifier_verify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	})
+
+	cfg := DefaultJWTConfig()
+	cfg.JWKSFile, cfg.Issuer, cfg.Audience = path, "https://idp.example.com", "verniy-mq"
+	v, err := NewJWTVerifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := func(extra map[string]any) map[string]any {
+		c := map[string]any{"sub": "billing", "iss": cfg.Issuer, "aud": []string{"verniy-mq"}, "exp": now.Add(time.Hour).Unix()}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+	rsaSigner := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	ecSigner := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	hmacSigner := func(key []byte) func([]byte) []byte {
+		return func(signed []byte) []byte {
+			mac := hmac.New(sha256.New, key)
+			mac.Write(signed)
+			return mac.Sum(nil)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		wantRoles []string
+		wantScope *APIKeyScope
+		wantErr   bool
+	}{
+		{
+			name:      "RS256",
+			token:     signJWT(t, "RS256", "rsa", claims(map[string]any{"roles": []string{"ops"}}), rsaSigner),
+			wantRoles: []string{"ops"},
+			// without admin rights
+			wantScope: &APIKeyScope{},
+		},
+		{
+			name:      "ES256 with scope",
+			token:     signJWT(t, "ES256", "ec", claims(map[string]any{"vmq_permissions": "publish consume", "vmq_queues": []string{"orders-*"}}), ecSigner),
+			wantScope: &APIKeyScope{Permissions: []Permission{PermissionPublish, PermissionConsume}, Queues: []string{"orders-*"}},
+		},
+		{
+			name:    "expired",
+			token:   signJWT(t, "RS256", "rsa", claims(map[string]any{"exp": now.Add(-time.Hour).Unix()}), rsaSigner),
+			wantErr: true,
+		},
+		{
+			name:    "wrong audience",
+			token:   signJWT(t, "RS256", "rsa", claims(map[string]any{"aud": "other"}), rsaSigner),
+			wantErr: true,
+		},
+		{
+			name:    "wrong key",
+			token:   signJWT(t, "ES256", "rsa", claims(nil), ecSigner),
+			wantErr: true,
+		},
+		{
+			// the RSA public key must not be usable as an HMAC secret
+			name:    "algorithm confusion",
+			token:   signJWT(t, "HS256", "rsa", claims(nil), hmacSigner(rsaKey.N.Bytes())),
+			wantErr: true,
+		},
+		{
+			name:    "unknown permission",
+			token:   signJWT(t, "RS256", "rsa", claims(map[string]any{"vmq_permissions": "purge"}), rsaSigner),
+			wantErr: true,
+		},
+		{
+			name:    "HS256 before the key is added",
+			token:   signJWT(t, "HS256", "hmac", claims(nil), hmacSigner(secret)),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account, scope, err := v.Verify(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if account.ID != "billing" || !reflect.DeepEqual(account.Roles, tt.wantRoles) {
+				t.Errorf("Verify() account = %+v", account)
+			}
+			if !reflect.DeepEqual(scope, tt.wantScope) {
+				t.Errorf("Verify() scope = %+v, want %+v", scope, tt.wantScope)
+			}
+		})
+	}
+
+	// tokens without scope claims keep the admin rights of their account
+	// only when allowed
+	adminCfg := cfg
+	adminCfg.AllowAdmin = true
+	admin, err := NewJWTVerifier(adminCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, scope, err := admin.Verify(signJWT(t, "RS256", "rsa", claims(nil), rsaSigner)); err != nil || scope != nil {
+		t.Errorf("Verify() allowing admin = %+v, %v, want no scope", scope, err)
+	}
+
+	// the key set is reloaded when it changes
+	hs256 := signJWT(t, "HS256", "hmac", claims(nil), hmacSigner(secret))
+	writeJWKS(t, path, []map[string]string{{"kty": "oct", "kid": "hmac", "k": b64(secret)}})
+	if err := os.Chtimes(path, now, now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := v.Verify(hs256); err != nil {
+		t.Errorf("Verify() after reload error = %v", err)
+	}
+
+	// a broken key set keeps the keys loaded before
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, now, now.Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := v.Verify(hs256); err != nil {
+		t.Errorf("Verify() after a failed reload error = %v", err)
+	}
+}
+
+func writeJWKS(t *testing.T, path string, keys []map[string]string) {
+	t.Helper()
+	b, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signJWT(t *testing.T, alg, kid string, claims map[string]any, sign func([]byte) []byte) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
@@ -1,19 +1,42 @@
 package src
 
+import (
+	"fmt"
+	"time"
+)
+
 // Message ...
 type Message struct {
-	ID   string
-	Data []byte
+	ID     string    `json:"id"`
+	Data   []byte    `json:"data"`
+	SentAt time.Time `json:"sent_at"`
+
+	// ReceiveCount is the number of times the message has been consumed.
+	ReceiveCount int `json:"receive_count"`
+
+	// codec is the compression of Data while the message is stored.
+	codec Codec
 }
 
 // NewMessage ...
 func NewMessage(rs RandomStringer, data []byte) (*Message, error) {
 	return &Message{
-		ID:   rs(),
-		Data: data,
+		ID:     rs(),
+		Data:   data,
+		SentAt: time.Now(),
 	}, nil
 }
 
+// decompress returns the message with its payload as published.
+func (m Message) decompress() (Message, error) {
+	data, err := m.codec.Decode(m.Data, 0)
+	if err != nil {
+		return Message{}, fmt.Errorf("message %s: %w", m.ID, err)
+	}
+	m.Data, m.codec = data, CodecNone
+	return m, nil
+}
+
 // RandomStringer ...
 type RandomStringer func() string
 
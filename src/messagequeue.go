@@ -1,59 +1,432 @@
 package src
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/verniyyy/verniy-mq/src/util"
 )
 
+// ErrQueueFull is returned by Publish when a queue with the reject overflow policy is at its limit.
+var ErrQueueFull = errors.New("queue is full")
+
+// ErrQueuePaused is returned by Publish or Consume while they are paused on a queue.
+var ErrQueuePaused = errors.New("queue is paused")
+
+// ErrMessageNotInFlight is returned by Delete or Nack for a message which
+// is not consumed, or whose visibility timeout has expired.
+var ErrMessageNotInFlight = errors.New("message is not in flight")
+
 // MessageQueue ...
 type MessageQueue interface {
 	Name() string
+	Rename(name string)
+	Attributes() QueueAttributes
+	Stats() QueueStats
+	LastActivity() time.Time
+	Touch()
 	Publish(*Message) error
 	Consume() (*Message, error)
 	Delete(id string) error
+	Nack(id string, delay time.Duration, incrementReceiveCount bool) error
+	Purge() int64
+	Browse(offset, limit int, includeInFlight bool) ([]MessageInfo, bool)
+	SetAttributes(attrs QueueAttributes, deadLetter func(Message) error)
+	DropExpiredMessages(now time.Time) int64
+}
+
+// MessageState ...
+type MessageState string
+
+const (
+	MessageReady    MessageState = "ready"
+	MessageInFlight MessageState = "in-flight"
+)
+
+// MessageInfo is a message seen without consuming it.
+type MessageInfo struct {
+	ID           string       `json:"id"`
+	State        MessageState `json:"state"`
+	Size         int          `json:"size"`
+	ReceiveCount int          `json:"receive_count"`
+	SentAt       time.Time    `json:"sent_at"`
+	Data         []byte       `json:"data"`
+}
+
+// newMessageInfo ...
+func newMessageInfo(m Message, state MessageState) MessageInfo {
+	return MessageInfo{
+		ID:           m.ID,
+		State:        state,
+		Size:         len(m.Data),
+		ReceiveCount: m.ReceiveCount,
+		SentAt:       m.SentAt,
+		Data:         m.Data,
+	}
+}
+
+// decompressedMessageInfo is the info of m with its payload as published.
+func decompressedMessageInfo(m Message, state MessageState) MessageInfo {
+	d, err := m.decompress()
+	if err != nil {
+		log.Printf("browse: %v\n", err)
+		return newMessageInfo(m, state)
+	}
+	return newMessageInfo(d, state)
+}
+
+// QueueStats ...
+type QueueStats struct {
+	Messages         int64 `json:"messages"`
+	Bytes            int64 `json:"bytes"`
+	InFlightMessages int64 `json:"in_flight_messages"`
+	DelayedMessages  int64 `json:"delayed_messages"`
+	// OldestMessageAge is the age of the message at the front of the queue.
+	OldestMessageAge util.Duration `json:"oldest_message_age"`
+
+	Published int64 `json:"published"`
+	Consumed  int64 `json:"consumed"`
+	Deleted   int64 `json:"deleted"`
+
+	CreatedAt  time.Time `json:"created_at"`
+	ModifiedAt time.Time `json:"modified_at"`
+
+	MaxLength int64 `json:"max_length,omitempty"`
+	MaxBytes  int64 `json:"max_bytes,omitempty"`
+	// LengthUsage and BytesUsage are the ratio of the limits in use.
+	LengthUsage float64 `json:"length_usage,omitempty"`
+	BytesUsage  float64 `json:"bytes_usage,omitempty"`
 }
 
 // NewMessageQueue ...
-func NewMessageQueue(name string) MessageQueue {
-	return &messageQueue{
+func NewMessageQueue(name string, attrs QueueAttributes) MessageQueue {
+	return newMessageQueue(name, attrs)
+}
+
+// newMessageQueue ...
+func newMessageQueue(name string, attrs QueueAttributes) *messageQueue {
+	now := time.Now()
+	mq := &messageQueue{
 		name:              name,
+		attrs:             attrs,
+		createdAt:         now,
+		modifiedAt:        now,
 		returnToQueueTime: 1 * time.Minute,
 		q:                 NewQueue[Message](),
-		kv:                NewKVStore[string, Message](),
+		kv:                NewKVStore[string, *lease](),
+		delayed:           NewKVStore[string, Message](),
 	}
+	mq.Touch()
+	return mq
 }
 
 // messageQueue ...
 type messageQueue struct {
 	name              string
+	attrs             QueueAttributes
 	returnToQueueTime time.Duration
 	q                 Queue[Message]
-	kv                KVStore[string, Message]
+	kv                KVStore[string, *lease]
+	delayed           KVStore[string, Message]
+	lastActivity      atomic.Int64
+
+	// mu guards the ready, in-flight and delayed messages together with
+	// bytes, held and usage, and the name and attributes.
+	mu    sync.Mutex
+	bytes int64
+	// heldMessages and heldBytes count the ready, delayed and in-flight
+	// messages, which are also counted on usage, the account owning the queue.
+	heldMessages int64
+	heldBytes    int64
+	usage        *usageCounter
+
+	createdAt  time.Time
+	modifiedAt time.Time
+	published  atomic.Int64
+	consumed   atomic.Int64
+	deleted    atomic.Int64
+
+	// deadLetter delivers a message to the dead-letter queue.
+	deadLetter func(Message) error
 }
 
 // Name ...
 func (mq *messageQueue) Name() string {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
 	return mq.name
 }
 
+// Rename changes the name only. Registering the queue under the new name is up to the MQManager.
+func (mq *messageQueue) Rename(name string) {
+	mq.Touch()
+
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	mq.name = name
+	mq.modifiedAt = time.Now()
+}
+
+// Attributes ...
+func (mq *messageQueue) Attributes() QueueAttributes {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	return mq.attrs
+}
+
+// SetAttributes replaces the attributes and the dead-letter delivery. New
+// limits are applied to the ready messages at once unless the overflow
+// policy is reject, and a shorter retention period drops old messages.
+// The visibility timeout and delay apply to messages consumed and
+// published afterwards.
+func (mq *messageQueue) SetAttributes(attrs QueueAttributes, deadLetter func(Message) error) {
+	mq.Touch()
+
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	mq.attrs = attrs
+	mq.deadLetter = deadLetter
+	mq.modifiedAt = time.Now()
+
+	if attrs.Overflow == OverflowDropHead || attrs.Overflow == OverflowDeadLetter {
+		if err := mq.makeRoom(0, 0); err != nil {
+			log.Printf("set attributes: %v\n", err)
+		}
+	}
+	mq.dropExpired(time.Now())
+}
+
+// visibilityTimeout ...
+func (mq *messageQueue) visibilityTimeout() time.Duration {
+	if d := mq.attrs.VisibilityTimeout.Std(); d > 0 {
+		return d
+	}
+	return mq.returnToQueueTime
+}
+
+// Stats ...
+func (mq *messageQueue) Stats() QueueStats {
+	mq.mu.Lock()
+	s := QueueStats{
+		Messages:         mq.q.Size(),
+		Bytes:            mq.bytes,
+		InFlightMessages: mq.kv.Size(),
+		DelayedMessages:  mq.delayed.Size(),
+		Published:        mq.published.Load(),
+		Consumed:         mq.consumed.Load(),
+		Deleted:          mq.deleted.Load(),
+		CreatedAt:        mq.createdAt,
+		ModifiedAt:       mq.modifiedAt,
+		MaxLength:        mq.attrs.MaxLength,
+		MaxBytes:         mq.attrs.MaxBytes,
+	}
+	if m, err := mq.q.Peek(); err == nil && !m.SentAt.IsZero() {
+		s.OldestMessageAge = util.Duration(time.Since(m.SentAt))
+	}
+	mq.mu.Unlock()
+
+	if s.MaxLength > 0 {
+		s.LengthUsage = float64(s.Messages) / float64(s.MaxLength)
+	}
+	if s.MaxBytes > 0 {
+		s.BytesUsage = float64(s.Bytes) / float64(s.MaxBytes)
+	}
+	return s
+}
+
+// LastActivity is the time of the last publish, consume or management operation.
+func (mq *messageQueue) LastActivity() time.Time {
+	return time.Unix(0, mq.lastActivity.Load())
+}
+
+// Touch records activity on the queue.
+func (mq *messageQueue) Touch() {
+	mq.lastActivity.Store(time.Now().UnixNano())
+}
+
 // Publish ...
-func (mq *messageQueue) Publish(m *Message) error {
-	return mq.q.Enqueue(*m)
+func (mq *messageQueue) Publish(msg *Message) error {
+	mq.Touch()
+
+	m, err := mq.compress(*msg)
+	if err != nil {
+		return err
+	}
+
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	if mq.attrs.PublishPaused {
+		return fmt.Errorf("%w: publish to queue \"%s\" is paused", ErrQueuePaused, mq.name)
+	}
+	if err := mq.makeRoom(1, int64(len(m.Data))); err != nil {
+		return err
+	}
+	if d := mq.attrs.Delay.Std(); d > 0 {
+		if err := mq.delay(m, d); err != nil {
+			return err
+		}
+	} else if err := mq.enqueue(m); err != nil {
+		return err
+	}
+	mq.hold(1, int64(len(m.Data)))
+
+	mq.published.Add(1)
+	return nil
+}
+
+// compress compresses the payload of m with the compression of the queue.
+func (mq *messageQueue) compress(m Message) (Message, error) {
+	return compressMessage(mq.Attributes().Compression, m)
+}
+
+// compressMessage compresses the payload of m with codec when it gets
+// smaller. Messages compressed already, e.g. dead letters, are kept as
+// they are.
+func compressMessage(codec Codec, m Message) (Message, error) {
+	if codec == CodecNone || m.codec != CodecNone {
+		return m, nil
+	}
+	data, err := codec.Encode(m.Data)
+	if err != nil {
+		return Message{}, err
+	}
+	if len(data) < len(m.Data) {
+		m.Data, m.codec = data, codec
+	}
+	return m, nil
+}
+
+// makeRoom applies the overflow policy until n more messages of size
+// bytes in total fit in the limits.
+func (mq *messageQueue) makeRoom(n, size int64) error {
+	maxLength, maxBytes := mq.attrs.MaxLength, mq.attrs.MaxBytes
+	if maxBytes > 0 && size > maxBytes {
+		return fmt.Errorf("%w: message size %d exceeds max bytes %d of queue \"%s\"",
+			ErrQueueFull, size, maxBytes, mq.name)
+	}
+
+	for {
+		overLength := maxLength > 0 && mq.q.Size()+n > maxLength
+		overBytes := maxBytes > 0 && mq.bytes+size > maxBytes
+		if !overLength && !overBytes {
+			return nil
+		}
+
+		switch mq.attrs.Overflow {
+		case OverflowDropHead:
+			m, err := mq.dequeue()
+			if err != nil {
+				return err
+			}
+			mq.hold(-1, -int64(len(m.Data)))
+			log.Printf("overflow: dropped message %s from queue %s\n", m.ID, mq.name)
+		case OverflowDeadLetter:
+			m, err := mq.q.Peek()
+			if err != nil {
+				return err
+			}
+			if err := mq.deliverDeadLetter(m); err != nil {
+				return fmt.Errorf("%w: dead-letter failed: %v", ErrQueueFull, err)
+			}
+			if _, err := mq.dequeue(); err != nil {
+				return err
+			}
+			mq.hold(-1, -int64(len(m.Data)))
+			log.Printf("overflow: dead-lettered message %s from queue %s\n", m.ID, mq.name)
+		default:
+			if overLength {
+				return fmt.Errorf("%w: queue \"%s\" has reached max length %d", ErrQueueFull, mq.name, maxLength)
+			}
+			return fmt.Errorf("%w: queue \"%s\" has reached max bytes %d", ErrQueueFull, mq.name, maxBytes)
+		}
+	}
+}
+
+// deliverDeadLetter ...
+func (mq *messageQueue) deliverDeadLetter(m Message) error {
+	if mq.deadLetter == nil {
+		return fmt.Errorf("dead-letter queue of \"%s\" is not configured", mq.name)
+	}
+	return mq.deadLetter(m)
+}
+
+// hold counts n more messages of size bytes in total as held by the
+// queue and its account. mu must be held.
+func (mq *messageQueue) hold(n, size int64) {
+	mq.heldMessages += n
+	mq.heldBytes += size
+	mq.usage.add(n, size)
+}
+
+// setUsage moves the messages held by the queue to the counter of the
+// account now owning it, nil for a queue which has been deleted.
+func (mq *messageQueue) setUsage(c *usageCounter) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	if c == mq.usage {
+		return
+	}
+	if mq.usage != nil {
+		mq.usage.queues.Add(-1)
+	}
+	if c != nil {
+		c.queues.Add(1)
+	}
+	mq.usage.add(-mq.heldMessages, -mq.heldBytes)
+	c.add(mq.heldMessages, mq.heldBytes)
+	mq.usage = c
+}
+
+// enqueue adds m to the ready queue. mu must be held.
+func (mq *messageQueue) enqueue(m Message) error {
+	if err := mq.q.Enqueue(m); err != nil {
+		return err
+	}
+	mq.bytes += int64(len(m.Data))
+	return nil
+}
+
+// dequeue removes the oldest message from the ready queue. mu must be held.
+func (mq *messageQueue) dequeue() (Message, error) {
+	m, err := mq.q.Dequeue()
+	if err != nil {
+		return m, err
+	}
+	mq.bytes -= int64(len(m.Data))
+	return m, nil
 }
 
 // Consume ...
 func (mq *messageQueue) Consume() (*Message, error) {
-	m, err := mq.q.Dequeue()
+	mq.Touch()
+
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	if mq.attrs.ConsumePaused {
+		return nil, fmt.Errorf("%w: consume from queue \"%s\" is paused", ErrQueuePaused, mq.name)
+	}
+	m, err := mq.dequeue()
 	if err != nil {
 		return nil, err
 	}
+	m.ReceiveCount++
+	mq.consumed.Add(1)
 
-	if err := mq.kv.Store(m.ID, m); err != nil {
+	l := &lease{m: m}
+	if err := mq.kv.Store(m.ID, l); err != nil {
 		return nil, err
 	}
-
-	time.AfterFunc(mq.returnToQueueTime, func() {
-		if err := mq.makeAvailable(m.ID); err != nil {
+	l.timer = time.AfterFunc(mq.visibilityTimeout(), func() {
+		if err := mq.makeAvailable(l); err != nil {
 			if err == ErrNotFound {
 				return
 			}
@@ -61,24 +434,236 @@ func (mq *messageQueue) Consume() (*Message, error) {
 		}
 	})
 
-	return &m, nil
+	// the message stays compressed in the lease
+	d, err := m.decompress()
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// lease is a consumed message waiting for Delete or Nack.
+type lease struct {
+	m     Message
+	timer *time.Timer
 }
 
-// makeAvailable ...
-func (mq *messageQueue) makeAvailable(id string) error {
-	m, err := mq.kv.GetAndDelete(id)
+// makeAvailable returns the message of an expired lease to the queue.
+func (mq *messageQueue) makeAvailable(l *lease) error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	id := l.m.ID
+	current, err := mq.kv.Get(id)
 	if err != nil {
 		return err
 	}
+	if current != l {
+		// the message has been returned and consumed again meanwhile
+		return ErrNotFound
+	}
+	if err := mq.kv.Delete(id); err != nil {
+		return err
+	}
 	defer func() {
 		log.Printf("makeAvailable: %+v\n", id)
 	}()
 
-	return mq.q.Enqueue(m)
+	return mq.requeue(l.m, 0)
+}
+
+// Nack returns an in-flight message to the queue after delay. Unless
+// incrementReceiveCount is set, the receive is not counted against the message.
+func (mq *messageQueue) Nack(id string, delay time.Duration, incrementReceiveCount bool) error {
+	mq.Touch()
+
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	l, err := mq.kv.GetAndDelete(id)
+	if err != nil {
+		return fmt.Errorf("%w: message ID \"%s\"", ErrMessageNotInFlight, id)
+	}
+	l.timer.Stop()
+
+	m := l.m
+	if !incrementReceiveCount && m.ReceiveCount > 0 {
+		m.ReceiveCount--
+	}
+
+	return mq.requeue(m, delay)
+}
+
+// requeue returns m to the queue after delay, or moves it to the
+// dead-letter queue if it has been received too many times. The delay is
+// extended to the one of the retry policy if that is longer. mu must be held.
+func (mq *messageQueue) requeue(m Message, delay time.Duration) error {
+	if dl := mq.attrs.DeadLetter; dl != nil && dl.MaxReceiveCount > 0 && m.ReceiveCount >= dl.MaxReceiveCount {
+		if err := mq.deliverDeadLetter(m); err != nil {
+			log.Printf("dead-letter failed: %v, message %s is returned to queue %s\n", err, m.ID, mq.name)
+			return mq.enqueue(m)
+		}
+		mq.hold(-1, -int64(len(m.Data)))
+		log.Printf("dead-lettered message %s from queue %s after %d receives\n", m.ID, mq.name, m.ReceiveCount)
+		return nil
+	}
+
+	if p := mq.attrs.Retry; p != nil {
+		if d := p.Delay(m.ReceiveCount, rand.Float64); d > delay {
+			delay = d
+		}
+	}
+	if delay <= 0 {
+		return mq.enqueue(m)
+	}
+	return mq.delay(m, delay)
+}
+
+// delay makes m ready after d. mu must be held.
+func (mq *messageQueue) delay(m Message, d time.Duration) error {
+	if err := mq.delayed.Store(m.ID, m); err != nil {
+		return err
+	}
+	id := m.ID
+	time.AfterFunc(d, func() {
+		mq.mu.Lock()
+		defer mq.mu.Unlock()
+
+		m, err := mq.delayed.GetAndDelete(id)
+		if err != nil {
+			return
+		}
+		if err := mq.enqueue(m); err != nil {
+			mq.hold(-1, -int64(len(m.Data)))
+			log.Printf("requeue: %v\n", err)
+		}
+	})
+	return nil
 }
 
 // Delete ...
 func (mq *messageQueue) Delete(id string) error {
-	_, err := mq.kv.GetAndDelete(id)
-	return err
+	mq.Touch()
+
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	l, err := mq.kv.GetAndDelete(id)
+	if err != nil {
+		return fmt.Errorf("%w: message ID \"%s\"", ErrMessageNotInFlight, id)
+	}
+	l.timer.Stop()
+	mq.hold(-1, -int64(len(l.m.Data)))
+
+	mq.deleted.Add(1)
+	return nil
+}
+
+// Purge removes every ready, delayed and in-flight message and returns how many were removed.
+func (mq *messageQueue) Purge() int64 {
+	mq.Touch()
+
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	n := mq.q.Size() + mq.delayed.Size()
+	mq.q.Init()
+	mq.delayed.Init()
+	mq.bytes = 0
+
+	_, leases, _ := mq.kv.GetAll()
+	for _, l := range leases {
+		l.timer.Stop()
+	}
+	mq.kv.Init()
+	mq.hold(-mq.heldMessages, -mq.heldBytes)
+
+	return n + int64(len(leases))
+}
+
+// Browse returns up to limit messages from offset without consuming them.
+// Ready messages come in queue order, followed by in-flight messages if
+// includeInFlight is set. It reports whether there are more messages.
+func (mq *messageQueue) Browse(offset, limit int, includeInFlight bool) ([]MessageInfo, bool) {
+	mq.Touch()
+
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	all := make([]Message, 0, mq.q.Size())
+	mq.q.Range(func(m Message) bool {
+		all = append(all, m)
+		return true
+	})
+	ready := len(all)
+	if includeInFlight {
+		_, leases, _ := mq.kv.GetAll()
+		inFlight := make([]Message, len(leases))
+		for i, l := range leases {
+			inFlight[i] = l.m
+		}
+		sort.Slice(inFlight, func(i, j int) bool {
+			return inFlight[i].ID < inFlight[j].ID
+		})
+		all = append(all, inFlight...)
+	}
+
+	if offset >= len(all) {
+		return []MessageInfo{}, false
+	}
+	end := offset + limit
+	if end > len(all) {
+		end = len(all)
+	}
+	// only the page is decompressed
+	page := make([]MessageInfo, 0, end-offset)
+	for i := offset; i < end; i++ {
+		state := MessageReady
+		if i >= ready {
+			state = MessageInFlight
+		}
+		page = append(page, decompressedMessageInfo(all[i], state))
+	}
+	return page, end < len(all)
+}
+
+// DropExpiredMessages removes the ready and delayed messages older than
+// the retention period and returns how many were removed.
+func (mq *messageQueue) DropExpiredMessages(now time.Time) int64 {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	return mq.dropExpired(now)
+}
+
+// dropExpired ... mu must be held.
+func (mq *messageQueue) dropExpired(now time.Time) int64 {
+	retention := mq.attrs.RetentionPeriod.Std()
+	if retention <= 0 {
+		return 0
+	}
+	expired := func(m Message) bool {
+		return !m.SentAt.IsZero() && now.Sub(m.SentAt) > retention
+	}
+
+	removed := mq.q.RemoveFunc(expired)
+	for _, m := range removed {
+		mq.bytes -= int64(len(m.Data))
+		mq.hold(-1, -int64(len(m.Data)))
+	}
+	n := int64(len(removed))
+
+	ids, delayed, _ := mq.delayed.GetAll()
+	for i, m := range delayed {
+		if expired(m) {
+			_ = mq.delayed.Delete(ids[i])
+			mq.hold(-1, -int64(len(m.Data)))
+			n++
+		}
+	}
+
+	if n > 0 {
+		log.Printf("retention: dropped %d messages from queue %s\n", n, mq.name)
+	}
+	return n
 }
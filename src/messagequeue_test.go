@@ -0,0 +1,175 @@
+package src
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_messageQueue_Publish_overflow(t *testing.T) {
+	tests := []struct {
+		name       string
+		attrs      QueueAttributes
+		publish    []string
+		wantErr    error
+		wantQueue  []string
+		wantDLQ    []string
+		wantLength int64
+		wantBytes  int64
+	}{
+		{
+			name:       "rejects over max length",
+			attrs:      QueueAttributes{MaxLength: 2},
+			publish:    []string{"a", "b", "c"},
+			wantErr:    ErrQueueFull,
+			wantQueue:  []string{"a", "b"},
+			wantLength: 2,
+			wantBytes:  2,
+		},
+		{
+			name:       "drops oldest over max bytes",
+			attrs:      QueueAttributes{MaxBytes: 4, Overflow: OverflowDropHead},
+			publish:    []string{"aa", "bb", "cc"},
+			wantQueue:  []string{"bb", "cc"},
+			wantLength: 2,
+			wantBytes:  4,
+		},
+		{
+			name:       "dead-letters oldest over max length",
+			attrs:      QueueAttributes{MaxLength: 1, Overflow: OverflowDeadLetter, DeadLetter: &DeadLetterPolicy{Queue: "dlq"}},
+			publish:    []string{"a", "b", "c"},
+			wantQueue:  []string{"c"},
+			wantDLQ:    []string{"a", "b"},
+			wantLength: 1,
+			wantBytes:  1,
+		},
+		{
+			name:       "rejects message larger than max bytes",
+			attrs:      QueueAttributes{MaxBytes: 1, Overflow: OverflowDropHead},
+			publish:    []string{"a", "bb"},
+			wantErr:    ErrQueueFull,
+			wantQueue:  []string{"a"},
+			wantLength: 1,
+			wantBytes:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dlq := newMessageQueue("dlq", QueueAttributes{})
+			mq := newMessageQueue("test", tt.attrs)
+			mq.deadLetter = func(m Message) error {
+				return dlq.Publish(&m)
+			}
+
+			var err error
+			for _, data := range tt.publish {
+				if e := mq.Publish(&Message{ID: data, Data: []byte(data)}); e != nil {
+					err = e
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want error = %v", err, tt.wantErr)
+			}
+
+			stats := mq.Stats()
+			if stats.Messages != tt.wantLength || stats.Bytes != tt.wantBytes {
+				t.Errorf("stats = %+v, want messages %d bytes %d", stats, tt.wantLength, tt.wantBytes)
+			}
+			if diff := cmp.Diff(drain(mq), tt.wantQueue); diff != "" {
+				t.Errorf("queue: %s", diff)
+			}
+			if diff := cmp.Diff(drain(dlq), tt.wantDLQ); diff != "" {
+				t.Errorf("dead-letter queue: %s", diff)
+			}
+		})
+	}
+}
+
+// drain consumes every ready message and returns their IDs.
+func drain(mq *messageQueue) []string {
+	var ids []string
+	for {
+		m, err := mq.Consume()
+		if err != nil {
+			return ids
+		}
+		ids = append(ids, m.ID)
+	}
+}
+
+func Test_messageQueue_Nack(t *testing.T) {
+	tests := []struct {
+		name                  string
+		attrs                 QueueAttributes
+		delay                 time.Duration
+		incrementReceiveCount bool
+		wantReady             int64
+		wantDelayed           int64
+		wantDLQ               int64
+		wantReceiveCount      int
+	}{
+		{
+			name:             "returns immediately without counting the receive",
+			wantReady:        1,
+			wantReceiveCount: 0,
+		},
+		{
+			name:                  "returns immediately counting the receive",
+			incrementReceiveCount: true,
+			wantReady:             1,
+			wantReceiveCount:      1,
+		},
+		{
+			name:        "returns after delay",
+			delay:       time.Hour,
+			wantDelayed: 1,
+		},
+		{
+			name:                  "dead-letters at max receive count",
+			attrs:                 QueueAttributes{DeadLetter: &DeadLetterPolicy{Queue: "dlq", MaxReceiveCount: 1}},
+			incrementReceiveCount: true,
+			wantDLQ:               1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dlq := newMessageQueue("dlq", QueueAttributes{})
+			mq := newMessageQueue("test", tt.attrs)
+			mq.deadLetter = func(m Message) error {
+				return dlq.Publish(&m)
+			}
+			if err := mq.Publish(&Message{ID: "a"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := mq.Consume(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := mq.Nack("a", tt.delay, tt.incrementReceiveCount); err != nil {
+				t.Fatal(err)
+			}
+			if err := mq.Nack("a", tt.delay, tt.incrementReceiveCount); err == nil {
+				t.Errorf("nack of a message not in flight succeeded")
+			}
+
+			stats := mq.Stats()
+			if stats.Messages != tt.wantReady || stats.DelayedMessages != tt.wantDelayed || stats.InFlightMessages != 0 {
+				t.Errorf("stats = %+v", stats)
+			}
+			if got := dlq.Stats().Messages; got != tt.wantDLQ {
+				t.Errorf("dead-letter messages = %d, want %d", got, tt.wantDLQ)
+			}
+			if tt.wantReady > 0 {
+				m, err := mq.q.Peek()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if m.ReceiveCount != tt.wantReceiveCount {
+					t.Errorf("ReceiveCount = %d, want %d", m.ReceiveCount, tt.wantReceiveCount)
+				}
+			}
+		})
+	}
+}
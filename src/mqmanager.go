@@ -2,111 +2,848 @@ package src
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/verniyyy/verniy-mq/src/util"
+)
+
+var (
+	// ErrQueueNotFound ...
+	ErrQueueNotFound = errors.New("queue is not found")
+	// ErrQueueExists ...
+	ErrQueueExists = errors.New("queue already exists")
 )
 
+// errQueueNotFound ...
+func errQueueNotFound(name string) error {
+	return fmt.Errorf("%w: queue name \"%s\"", ErrQueueNotFound, name)
+}
+
+// errQueueExists ...
+func errQueueExists(name string) error {
+	return fmt.Errorf("%w: queue name \"%s\"", ErrQueueExists, name)
+}
+
 // MQManager ...
 type MQManager interface {
-	CreateQueue(userID, name string) error
-	GetQueue(userID, name string) (MessageQueue, error)
-	ListQueues(userID string) ([]MessageQueue, error)
-	DeleteQueue(userID, name string) error
+	CreateQueue(owner Owner, name string, attrs QueueAttributes) error
+	GetQueue(owner Owner, name string) (MessageQueue, error)
+	ListQueues(owner Owner) ([]MessageQueue, error)
+	UpdateQueueAttributes(owner Owner, name string, update func(*QueueAttributes) error) error
+	DeleteQueue(owner Owner, name string) error
+	ListQueuesByTags(owner Owner, sel TagSelector) ([]MessageQueue, error)
+	TagQueue(owner Owner, name string, tags map[string]string) error
+	UntagQueue(owner Owner, name string, keys []string) error
+	QueueTags(owner Owner, name string) (map[string]string, error)
+	Catalog() []QueueEntry
+	RenameQueue(owner Owner, name, newName string) error
+	TransferQueue(owner Owner, name, newAccountID string) error
+	ExpiredQueues() int64
+	Grant(owner Owner, g Grant) error
+	Revoke(owner Owner, grantee, queue string) error
+	Grants(owner Owner) []Grant
+	Allowed(owner Owner, name string, p Principal, perm Permission) bool
+	Quota(accountID string) Quota
+	Usage(accountID string) QuotaUsage
+	Throttle(accountID string, mq MessageQueue, op Permission) error
+}
+
+// MQManagerConfig ...
+type MQManagerConfig struct {
+	// AdminAccountID and AdminTopic name the queue which receives
+	// notifications about idle queues. Notifications are dropped when unset.
+	AdminAccountID string
+	AdminTopic     string
+
+	// ExpiryGracePeriod is how long an idle queue is kept after
+	// the expiring notification before it is deleted.
+	ExpiryGracePeriod time.Duration
+
+	// ExpiryCheckInterval is how often idle queues are looked for.
+	ExpiryCheckInterval time.Duration
+
+	// Quotas returns the quotas of the accounts. Nil leaves them unlimited.
+	Quotas QuotaSource
+
+	// RateLimits are the rate limits of each account over all its queues.
+	RateLimits RateLimits
+}
+
+// DefaultMQManagerConfig ...
+func DefaultMQManagerConfig() MQManagerConfig {
+	return MQManagerConfig{
+		ExpiryGracePeriod:   1 * time.Minute,
+		ExpiryCheckInterval: 10 * time.Second,
+	}
 }
 
 // NewMQManager ...
-func NewMQManager() MQManager {
-	return &mqManager{
-		mqList: NewKVStore[queueID, MessageQueue](),
+func NewMQManager(cfg MQManagerConfig) MQManager {
+	m := &mqManager{
+		cfg:     cfg,
+		mqList:  NewKVStore[queueKey, MessageQueue](),
+		index:   make(map[Owner]map[string]*catalogEntry),
+		grants:  make(map[Owner][]Grant),
+		usage:   make(map[string]*usageCounter),
+		limiter: newRateLimiter(),
+	}
+	if cfg.ExpiryCheckInterval > 0 {
+		go m.runExpiry(cfg.ExpiryCheckInterval)
 	}
+	return m
 }
 
 // mqManager ...
 type mqManager struct {
-	mqList KVStore[queueID, MessageQueue]
+	cfg MQManagerConfig
+	// mu serializes changes to mqList and guards index.
+	mu     sync.Mutex
+	mqList KVStore[queueKey, MessageQueue]
+	// index is the queue catalog by owner and queue name.
+	index map[Owner]map[string]*catalogEntry
+	// grants are the access control lists by owner.
+	grants map[Owner][]Grant
+	// usage counts what each account holds over its namespaces.
+	usage   map[string]*usageCounter
+	expired atomic.Int64
+	limiter *rateLimiter
 }
 
 // CreateQueue ...
-func (m *mqManager) CreateQueue(userID, name string) error {
-	id := encodeQueueID(userID, name)
+func (m *mqManager) CreateQueue(owner Owner, name string, attrs QueueAttributes) error {
+	if err := ValidateQueueName(name); err != nil {
+		return err
+	}
+	if err := attrs.Validate(); err != nil {
+		return err
+	}
+	id := newQueueKey(owner, name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	_, err := m.mqList.Get(id)
 	if err != nil && err != ErrNotFound {
 		return err
 	}
 	if err == nil {
-		return fmt.Errorf("queue name \"%s\" is already stored", name)
+		return errQueueExists(name)
+	}
+	if err := m.checkQueueQuota(owner.AccountID); err != nil {
+		return err
 	}
 
-	return m.mqList.Store(id, NewMessageQueue(name))
+	deadLetter, err := m.resolveDeadLetter(owner, name, attrs)
+	if err != nil {
+		return err
+	}
+	mq := newMessageQueue(name, attrs)
+	mq.deadLetter = deadLetter
+
+	return m.store(id, mq, &catalogEntry{})
+}
+
+// catalogEntry is what the catalog holds on a queue besides the queue itself.
+type catalogEntry struct {
+	tags map[string]string
+}
+
+// store registers mq under key with entry, counting it on the usage of
+// the account of key. m.mu must be held.
+func (m *mqManager) store(key queueKey, mq MessageQueue, entry *catalogEntry) error {
+	if err := m.mqList.Store(key, mq); err != nil {
+		return err
+	}
+	m.setUsage(mq, m.usageCounter(key.owner.AccountID))
+
+	names, ok := m.index[key.owner]
+	if !ok {
+		names = make(map[string]*catalogEntry)
+		m.index[key.owner] = names
+	}
+	names[key.name] = entry
+	return nil
+}
+
+// remove unregisters the queue of key. It stays on the usage of its
+// account until drop or store is called with it. m.mu must be held.
+func (m *mqManager) remove(key queueKey) error {
+	if err := m.mqList.Delete(key); err != nil {
+		return err
+	}
+
+	names := m.index[key.owner]
+	delete(names, key.name)
+	if len(names) == 0 {
+		delete(m.index, key.owner)
+	}
+	return nil
+}
+
+// UpdateQueueAttributes applies update to the attributes of a queue
+// atomically. The queue is left unchanged if update fails or the
+// updated attributes are invalid.
+func (m *mqManager) UpdateQueueAttributes(owner Owner, name string, update func(*QueueAttributes) error) error {
+	id := newQueueKey(owner, name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mq, err := m.mqList.Get(id)
+	if err != nil {
+		return errQueueNotFound(name)
+	}
+
+	// the policies of the queue are not changed in place by update
+	attrs := mq.Attributes().clone()
+	if err := update(&attrs); err != nil {
+		return err
+	}
+	if err := attrs.Validate(); err != nil {
+		return err
+	}
+	deadLetter, err := m.resolveDeadLetter(owner, name, attrs)
+	if err != nil {
+		return err
+	}
+
+	mq.SetAttributes(attrs, deadLetter)
+	return nil
+}
+
+// resolveDeadLetter checks the dead-letter queue of attrs and returns the
+// function delivering to it. m.mu must be held.
+func (m *mqManager) resolveDeadLetter(owner Owner, name string, attrs QueueAttributes) (func(Message) error, error) {
+	if attrs.DeadLetter == nil {
+		return nil, nil
+	}
+
+	dlqName := attrs.DeadLetter.Queue
+	if dlqName == name {
+		return nil, fmt.Errorf("%w: queue \"%s\" can not be its own dead-letter queue", ErrInvalidArgument, name)
+	}
+	if _, err := m.mqList.Get(newQueueKey(owner, dlqName)); err != nil {
+		return nil, fmt.Errorf("%w: dead-letter queue name \"%s\" is not found", ErrInvalidArgument, dlqName)
+	}
+	// a queue delivers to its dead-letter queue holding its own lock, so a
+	// cycle would deadlock the queues on it
+	if m.deadLetterChainHas(owner, dlqName, name) {
+		return nil, fmt.Errorf("%w: dead-letter queue \"%s\" of queue \"%s\" leads back to it", ErrInvalidArgument, dlqName, name)
+	}
+
+	return m.deadLetterFunc(owner, dlqName), nil
+}
+
+// deadLetterChainHas reports whether the chain of dead-letter queues from
+// the queue of owner named start reaches name. m.mu must be held.
+func (m *mqManager) deadLetterChainHas(owner Owner, start, name string) bool {
+	seen := make(map[string]bool)
+	for q := start; !seen[q]; {
+		seen[q] = true
+		mq, err := m.mqList.Get(newQueueKey(owner, q))
+		if err != nil {
+			return false
+		}
+		dl := mq.Attributes().DeadLetter
+		if dl == nil {
+			return false
+		}
+		if dl.Queue == name {
+			return true
+		}
+		q = dl.Queue
+	}
+	return false
+}
+
+// deadLetterFunc returns a function which publishes messages to the queue of owner named dlqName.
+func (m *mqManager) deadLetterFunc(owner Owner, dlqName string) func(Message) error {
+	return func(msg Message) error {
+		dlq, err := m.GetQueue(owner, dlqName)
+		if err != nil {
+			return err
+		}
+		return dlq.Publish(&msg)
+	}
 }
 
 // GetQueue ...
-func (m *mqManager) GetQueue(userID, name string) (MessageQueue, error) {
-	id := encodeQueueID(userID, name)
+func (m *mqManager) GetQueue(owner Owner, name string) (MessageQueue, error) {
+	id := newQueueKey(owner, name)
 	q, err := m.mqList.Get(id)
 	if err != nil && err == ErrNotFound {
-		return nil, fmt.Errorf("queue name \"%s\" is not found", name)
+		return nil, errQueueNotFound(name)
 	}
 
 	return q, nil
 }
 
 // ListQueues ...
-func (m *mqManager) ListQueues(userID string) ([]MessageQueue, error) {
-	keys, values, err := m.mqList.GetAll()
-	if err != nil {
-		return nil, err
-	}
-	if len(keys) == 0 {
-		return make([]MessageQueue, 0), nil
+func (m *mqManager) ListQueues(owner Owner) ([]MessageQueue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.listQueues(owner)
+}
+
+// ListQueuesByTags lists the queues of owner whose tags match sel in name order.
+func (m *mqManager) ListQueuesByTags(owner Owner, sel TagSelector) ([]MessageQueue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.listQueuesByTags(owner, sel)
+}
+
+// listQueues returns the queues of owner in name order. m.mu must be held.
+func (m *mqManager) listQueues(owner Owner) ([]MessageQueue, error) {
+	return m.listQueuesByTags(owner, nil)
+}
+
+// listQueuesByTags ... m.mu must be held.
+func (m *mqManager) listQueuesByTags(owner Owner, sel TagSelector) ([]MessageQueue, error) {
+	names := make([]string, 0, len(m.index[owner]))
+	for name, entry := range m.index[owner] {
+		if !sel.Matches(entry.tags) {
+			continue
+		}
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	arg := userID
-	result := make([]MessageQueue, 0)
-	for i, k := range keys {
-		userID, name, err := decodeQueueID(k)
+	result := make([]MessageQueue, 0, len(names))
+	for _, name := range names {
+		mq, err := m.mqList.Get(newQueueKey(owner, name))
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("queue index is broken: %w", errQueueNotFound(name))
+		}
+		result = append(result, mq)
+	}
+
+	return result, nil
+}
+
+// TagQueue adds tags to a queue, replacing the values of existing keys.
+func (m *mqManager) TagQueue(owner Owner, name string, tags map[string]string) error {
+	if err := ValidateTags(tags); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.index[owner][name]
+	if !ok {
+		return errQueueNotFound(name)
+	}
+
+	merged := make(map[string]string, len(entry.tags)+len(tags))
+	for k, v := range entry.tags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	if len(merged) > maxTagsPerQueue {
+		return fmt.Errorf("%w: a queue can have up to %d tags", ErrInvalidArgument, maxTagsPerQueue)
+	}
+
+	entry.tags = merged
+	return nil
+}
+
+// UntagQueue removes the tags of keys from a queue.
+func (m *mqManager) UntagQueue(owner Owner, name string, keys []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.index[owner][name]
+	if !ok {
+		return errQueueNotFound(name)
+	}
+
+	tags := make(map[string]string, len(entry.tags))
+	for k, v := range entry.tags {
+		tags[k] = v
+	}
+	for _, k := range keys {
+		delete(tags, k)
+	}
+
+	entry.tags = tags
+	return nil
+}
+
+// QueueTags ...
+func (m *mqManager) QueueTags(owner Owner, name string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.index[owner][name]
+	if !ok {
+		return nil, errQueueNotFound(name)
+	}
+
+	tags := make(map[string]string, len(entry.tags))
+	for k, v := range entry.tags {
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+// QueueEntry is a queue in the catalog.
+type QueueEntry struct {
+	Owner Owner
+	Name  string
+	Tags  map[string]string
+	Queue MessageQueue
+}
+
+// Catalog returns every queue of the server.
+func (m *mqManager) Catalog() []QueueEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []QueueEntry
+	for owner, names := range m.index {
+		for name, entry := range names {
+			mq, err := m.mqList.Get(newQueueKey(owner, name))
+			if err != nil {
+				continue
+			}
+			entries = append(entries, QueueEntry{
+				Owner: owner,
+				Name:  name,
+				Tags:  entry.tags,
+				Queue: mq,
+			})
 		}
-		if userID != arg {
+	}
+	return entries
+}
+
+// DeleteQueue ...
+func (m *mqManager) DeleteQueue(owner Owner, name string) error {
+	id := newQueueKey(owner, name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mq, err := m.mqList.Get(id)
+	if err != nil {
+		return errQueueNotFound(name)
+	}
+
+	return m.drop(id, mq)
+}
+
+// drop unregisters the queue mq of key and takes it off the usage of its
+// account. m.mu must be held.
+func (m *mqManager) drop(key queueKey, mq MessageQueue) error {
+	if err := m.remove(key); err != nil {
+		return err
+	}
+	m.setUsage(mq, nil)
+	return nil
+}
+
+// usageCounter returns the usage of an account. m.mu must be held.
+func (m *mqManager) usageCounter(accountID string) *usageCounter {
+	c, ok := m.usage[accountID]
+	if !ok {
+		c = &usageCounter{}
+		m.usage[accountID] = c
+	}
+	return c
+}
+
+// setUsage makes mq count on c.
+func (m *mqManager) setUsage(mq MessageQueue, c *usageCounter) {
+	if mq, ok := mq.(*messageQueue); ok {
+		mq.setUsage(c)
+	}
+}
+
+// RenameQueue renames a queue keeping its messages and in-flight leases.
+// Dead-letter policies of the account naming the queue follow the rename.
+func (m *mqManager) RenameQueue(owner Owner, name, newName string) error {
+	if newName == name {
+		return nil
+	}
+	if err := ValidateQueueName(newName); err != nil {
+		return err
+	}
+	id, newID := newQueueKey(owner, name), newQueueKey(owner, newName)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mq, err := m.mqList.Get(id)
+	if err != nil {
+		return errQueueNotFound(name)
+	}
+	if _, err := m.mqList.Get(newID); err == nil {
+		return errQueueExists(newName)
+	}
+
+	if err := m.store(newID, mq, m.index[id.owner][id.name]); err != nil {
+		return err
+	}
+	if err := m.remove(id); err != nil {
+		return err
+	}
+	mq.Rename(newName)
+
+	queues, err := m.listQueues(owner)
+	if err != nil {
+		return err
+	}
+	for _, q := range queues {
+		attrs := q.Attributes()
+		if attrs.DeadLetter == nil || attrs.DeadLetter.Queue != name {
 			continue
 		}
-		if name != values[i].Name() {
-			return nil, fmt.Errorf("invalid queue")
+		dl := *attrs.DeadLetter
+		dl.Queue = newName
+		attrs.DeadLetter = &dl
+		q.SetAttributes(attrs, m.deadLetterFunc(owner, newName))
+	}
+
+	return nil
+}
+
+// TransferQueue hands a queue to the account newAccountID, in the same
+// namespace, keeping its messages
+// and in-flight leases. Queues in a dead-letter relation can not be
+// transferred since the relation is scoped to the account.
+func (m *mqManager) TransferQueue(owner Owner, name, newAccountID string) error {
+	if newAccountID == owner.AccountID {
+		return nil
+	}
+	id, newID := newQueueKey(owner, name), newQueueKey(Owner{AccountID: newAccountID, Namespace: owner.Namespace}, name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mq, err := m.mqList.Get(id)
+	if err != nil {
+		return errQueueNotFound(name)
+	}
+	if _, err := m.mqList.Get(newID); err == nil {
+		return errQueueExists(name)
+	}
+	if err := m.checkQueueQuota(newAccountID); err != nil {
+		return err
+	}
+
+	if mq.Attributes().DeadLetter != nil {
+		return fmt.Errorf("%w: queue \"%s\" has a dead-letter queue", ErrInvalidArgument, name)
+	}
+	queues, err := m.listQueues(owner)
+	if err != nil {
+		return err
+	}
+	for _, q := range queues {
+		if dl := q.Attributes().DeadLetter; dl != nil && dl.Queue == name {
+			return fmt.Errorf("%w: queue \"%s\" is the dead-letter queue of \"%s\"", ErrInvalidArgument, name, q.Name())
 		}
-		result = append(result, values[i])
 	}
 
-	return result, nil
+	if err := m.store(newID, mq, m.index[id.owner][id.name]); err != nil {
+		return err
+	}
+	if err := m.remove(id); err != nil {
+		return err
+	}
+	mq.Touch()
+	return nil
 }
 
-// DeleteQueue ...
-func (m *mqManager) DeleteQueue(userID, name string) error {
-	id := encodeQueueID(userID, name)
-	if _, err := m.mqList.Get(id); err != nil {
-		return fmt.Errorf("queue name \"%s\" is not found", name)
+// Grant adds g to the access control list of owner, replacing the
+// permissions of a grant for the same grantee and queue pattern.
+func (m *mqManager) Grant(owner Owner, g Grant) error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	grants := make([]Grant, 0, len(m.grants[owner])+1)
+	for _, granted := range m.grants[owner] {
+		if granted.Grantee != g.Grantee || granted.Queue != g.Queue {
+			grants = append(grants, granted)
+		}
+	}
+	m.grants[owner] = append(grants, g)
+	return nil
+}
+
+// Revoke removes the grant for grantee and queue pattern from the access control list of owner.
+func (m *mqManager) Revoke(owner Owner, grantee, queue string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	grants := make([]Grant, 0, len(m.grants[owner]))
+	for _, granted := range m.grants[owner] {
+		if granted.Grantee != grantee || granted.Queue != queue {
+			grants = append(grants, granted)
+		}
+	}
+	if len(grants) == len(m.grants[owner]) {
+		return fmt.Errorf("%w: no grant for %s on \"%s\"", ErrInvalidArgument, grantee, queue)
+	}
+	if len(grants) == 0 {
+		delete(m.grants, owner)
+		return nil
+	}
+	m.grants[owner] = grants
+	return nil
+}
+
+// Grants returns the access control list of owner.
+func (m *mqManager) Grants(owner Owner) []Grant {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Grant{}, m.grants[owner]...)
+}
+
+// Quota returns the quota of an account.
+func (m *mqManager) Quota(accountID string) Quota {
+	if m.cfg.Quotas == nil {
+		return Quota{}
 	}
+	return m.cfg.Quotas(accountID)
+}
+
+// Usage returns what an account holds over all its namespaces.
+func (m *mqManager) Usage(accountID string) QuotaUsage {
+	m.mu.Lock()
+	c, ok := m.usage[accountID]
+	m.mu.Unlock()
+
+	if !ok {
+		return QuotaUsage{}
+	}
+	return c.usage()
+}
+
+// Throttle takes a token for op on mq, owned by accountID, from the rate
+// limits of the account and of the queue.
+func (m *mqManager) Throttle(accountID string, mq MessageQueue, op Permission) error {
+	reqs := []rateLimitRequest{{
+		id:    accountID,
+		limit: m.cfg.RateLimits.limit(op),
+		name:  fmt.Sprintf("%s rate limit of account \"%s\"", op, accountID),
+	}}
+	if l := mq.Attributes().RateLimit; l != nil {
+		reqs = append(reqs, rateLimitRequest{
+			id:    mq,
+			limit: l.limit(op),
+			name:  fmt.Sprintf("%s rate limit of queue \"%s\"", op, mq.Name()),
+		})
+	}
+	return m.limiter.take(op, reqs...)
+}
+
+// checkQueueQuota checks that the account can have one more queue. m.mu must be held.
+func (m *mqManager) checkQueueQuota(accountID string) error {
+	q := m.Quota(accountID)
+	if q.MaxQueues == 0 {
+		return nil
+	}
+	if m.usageCounter(accountID).usage().Queues >= q.MaxQueues {
+		return fmt.Errorf("%w: account \"%s\" has reached max queues %d", ErrQuotaExceeded, accountID, q.MaxQueues)
+	}
+	return nil
+}
+
+// Allowed reports whether a grant of owner gives p the permission perm on the queue name.
+func (m *mqManager) Allowed(owner Owner, name string, p Principal, perm Permission) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, g := range m.grants[owner] {
+		if g.allows(p, name, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpiredQueues is the number of queues deleted for being idle.
+func (m *mqManager) ExpiredQueues() int64 {
+	return m.expired.Load()
+}
+
+// runExpiry deletes queues which have been idle longer than their
+// expires_after attribute plus the grace period, and drops messages older
+// than the retention period of their queue.
+func (m *mqManager) runExpiry(interval time.Duration) {
+	// notified holds the activity time each queue had when the expiring
+	// notification was sent, so activity in the grace period cancels it.
+	notified := make(map[queueKey]time.Time)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for now := range t.C {
+		keys, values, err := m.mqList.GetAll()
+		if err != nil {
+			log.Printf("expiry: %v\n", err)
+			continue
+		}
+
+		seen := make(map[queueKey]struct{}, len(keys))
+		for i, id := range keys {
+			seen[id] = struct{}{}
+			mq := values[i]
+			mq.DropExpiredMessages(now)
+
+			expiresAfter := mq.Attributes().ExpiresAfter.Std()
+			if expiresAfter <= 0 {
+				continue
+			}
+
+			last := mq.LastActivity()
+			if now.Sub(last) < expiresAfter {
+				delete(notified, id)
+				continue
+			}
+
+			deleteAt := last.Add(expiresAfter + m.cfg.ExpiryGracePeriod)
+			if at, ok := notified[id]; !ok || !at.Equal(last) {
+				notified[id] = last
+				m.notifyExpiry(id, "queue.expiring", last, deleteAt)
+			}
+			if now.Before(deleteAt) {
+				continue
+			}
+
+			if err := m.expireQueue(id, mq); err != nil {
+				log.Printf("expiry: %v\n", err)
+				continue
+			}
+			delete(notified, id)
+			m.notifyExpiry(id, "queue.expired", last, deleteAt)
+		}
 
-	return m.mqList.Delete(id)
+		for id := range notified {
+			if _, ok := seen[id]; !ok {
+				delete(notified, id)
+			}
+		}
+	}
 }
 
-// queueID ...
-type queueID string
+// expireQueue deletes the queue unless it has been replaced or touched meanwhile.
+func (m *mqManager) expireQueue(id queueKey, mq MessageQueue) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-const queueIDEncodeFmt = "{\"userID\":\"%v\",\"name\":\"%v\"}"
+	current, err := m.mqList.Get(id)
+	if err != nil {
+		return err
+	}
+	if current != mq || time.Since(mq.LastActivity()) < mq.Attributes().ExpiresAfter.Std() {
+		return nil
+	}
+	if err := m.drop(id, mq); err != nil {
+		return err
+	}
 
-// encodeQueueID ...
-func encodeQueueID(userID, name string) queueID {
-	return queueID(fmt.Sprintf(queueIDEncodeFmt, userID, name))
+	n := m.expired.Add(1)
+	log.Printf("queue expired: %s, last activity %v, expired queues %d\n", id, mq.LastActivity(), n)
+	return nil
 }
 
-// decodeQueueID ...
-func decodeQueueID(id queueID) (userID, name string, err error) {
-	v := make(map[string]string)
-	if err := json.Unmarshal([]byte(id), &v); err != nil {
-		fmt.Printf("err: %v\n", err.Error())
-		return "", "", err
+// queueExpiryNotification is published to the admin topic.
+type queueExpiryNotification struct {
+	Event        string    `json:"event"`
+	UserID       string    `json:"user_id"`
+	Namespace    string    `json:"namespace,omitempty"`
+	Queue        string    `json:"queue"`
+	LastActivity time.Time `json:"last_activity"`
+	DeleteAt     time.Time `json:"delete_at"`
+}
+
+// notifyExpiry ...
+func (m *mqManager) notifyExpiry(id queueKey, event string, last, deleteAt time.Time) {
+	if m.cfg.AdminTopic == "" {
+		return
+	}
+
+	data, err := json.Marshal(queueExpiryNotification{
+		Event:        event,
+		UserID:       id.owner.AccountID,
+		Namespace:    id.owner.Namespace,
+		Queue:        id.name,
+		LastActivity: last,
+		DeleteAt:     deleteAt,
+	})
+	if err != nil {
+		log.Printf("expiry notification: %v\n", err)
+		return
 	}
 
-	return v["userID"], v["name"], nil
+	admin, err := m.mqList.Get(newQueueKey(Owner{AccountID: m.cfg.AdminAccountID}, m.cfg.AdminTopic))
+	if err != nil {
+		log.Printf("expiry notification: admin topic \"%s\" is not found\n", m.cfg.AdminTopic)
+		return
+	}
+	msg, err := NewMessage(util.GenULID, data)
+	if err != nil {
+		log.Printf("expiry notification: %v\n", err)
+		return
+	}
+	if err := admin.Publish(msg); err != nil {
+		log.Printf("expiry notification: %v\n", err)
+	}
+}
+
+// queueKey identifies a queue by its owner and name.
+type queueKey struct {
+	owner Owner
+	name  string
+}
+
+// newQueueKey ...
+func newQueueKey(owner Owner, name string) queueKey {
+	return queueKey{owner: owner, name: name}
+}
+
+// String ...
+func (k queueKey) String() string {
+	return strconv.Quote(k.owner.String()) + "/" + strconv.Quote(k.name)
+}
+
+// MaxQueueNameLength ...
+const MaxQueueNameLength = 80
+
+// ValidateQueueName checks the queue name grammar: 1 to 80 characters of
+// ASCII letters, digits, hyphens and underscores.
+func ValidateQueueName(name string) error {
+	return validateName("queue name", name, MaxQueueNameLength)
+}
+
+// validateName checks the name grammar shared by queues, namespaces and
+// accounts.
+func validateName(kind, name string, maxLength int) error {
+	if name == "" || len(name) > maxLength {
+		return fmt.Errorf("%w: %s must be 1 to %d characters", ErrInvalidArgument, kind, maxLength)
+	}
+	for _, c := range name {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_':
+		default:
+			return fmt.Errorf("%w: %s \"%s\" contains invalid character %q", ErrInvalidArgument, kind, name, c)
+		}
+	}
+	return nil
 }
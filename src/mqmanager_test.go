@@ -0,0 +1,300 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/verniyyy/verniy-mq/src/util"
+)
+
+func Test_mqManager_runExpiry(t *testing.T) {
+	m := NewMQManager(MQManagerConfig{
+		AdminAccountID:      "admin",
+		AdminTopic:          "notifications",
+		ExpiryGracePeriod:   50 * time.Millisecond,
+		ExpiryCheckInterval: 10 * time.Millisecond,
+	})
+	if err := m.CreateQueue(Owner{AccountID: "admin"}, "notifications", QueueAttributes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateQueue(Owner{AccountID: "user"}, "ephemeral", QueueAttributes{
+		ExpiresAfter: util.Duration(50 * time.Millisecond),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if _, err := m.GetQueue(Owner{AccountID: "user"}, "ephemeral"); err == nil {
+		t.Errorf("queue is not expired")
+	}
+	if got := m.ExpiredQueues(); got != 1 {
+		t.Errorf("ExpiredQueues() = %v, want 1", got)
+	}
+
+	admin, err := m.GetQueue(Owner{AccountID: "admin"}, "notifications")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	for {
+		msg, err := admin.Consume()
+		if err != nil {
+			break
+		}
+		var n queueExpiryNotification
+		if err := json.Unmarshal(msg.Data, &n); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, n.Event)
+	}
+	if len(events) != 2 || events[0] != "queue.expiring" || events[1] != "queue.expired" {
+		t.Errorf("events = %v", events)
+	}
+}
+
+func Test_mqManager_RenameQueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		wantErr error
+	}{
+		{
+			name: "renames keeping messages",
+			from: "orders",
+			to:   "orders-v2",
+		},
+		{
+			name:    "fails if the target exists",
+			from:    "orders",
+			to:      "orders-dlq",
+			wantErr: ErrQueueExists,
+		},
+		{
+			name:    "fails if the source does not exist",
+			from:    "unknown",
+			to:      "orders-v2",
+			wantErr: ErrQueueNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMQManager(MQManagerConfig{})
+			if err := m.CreateQueue(Owner{AccountID: "user"}, "orders", QueueAttributes{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.CreateQueue(Owner{AccountID: "user"}, "orders-dlq", QueueAttributes{}); err != nil {
+				t.Fatal(err)
+			}
+			mq, _ := m.GetQueue(Owner{AccountID: "user"}, "orders")
+			if err := mq.Publish(&Message{ID: "a"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := mq.Consume(); err != nil {
+				t.Fatal(err)
+			}
+
+			err := m.RenameQueue(Owner{AccountID: "user"}, tt.from, tt.to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want error = %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if _, err := m.GetQueue(Owner{AccountID: "user"}, tt.from); !errors.Is(err, ErrQueueNotFound) {
+				t.Errorf("old name still resolves: %v", err)
+			}
+			renamed, err := m.GetQueue(Owner{AccountID: "user"}, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if renamed.Name() != tt.to {
+				t.Errorf("Name() = %v, want %v", renamed.Name(), tt.to)
+			}
+			if err := renamed.Delete("a"); err != nil {
+				t.Errorf("in-flight lease is lost: %v", err)
+			}
+		})
+	}
+}
+
+func Test_mqManager_RenameQueue_deadLetter(t *testing.T) {
+	m := NewMQManager(MQManagerConfig{})
+	if err := m.CreateQueue(Owner{AccountID: "user"}, "dlq", QueueAttributes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateQueue(Owner{AccountID: "user"}, "orders", QueueAttributes{
+		MaxLength:  1,
+		Overflow:   OverflowDeadLetter,
+		DeadLetter: &DeadLetterPolicy{Queue: "dlq"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RenameQueue(Owner{AccountID: "user"}, "dlq", "orders-dlq"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.TransferQueue(Owner{AccountID: "user"}, "orders-dlq", "other"); err == nil {
+		t.Errorf("transfer of a dead-letter queue succeeded")
+	}
+
+	orders, _ := m.GetQueue(Owner{AccountID: "user"}, "orders")
+	if got := orders.Attributes().DeadLetter.Queue; got != "orders-dlq" {
+		t.Errorf("dead-letter queue = %v, want orders-dlq", got)
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := orders.Publish(&Message{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dlq, _ := m.GetQueue(Owner{AccountID: "user"}, "orders-dlq")
+	if got := dlq.Stats().Messages; got != 1 {
+		t.Errorf("dead-letter messages = %v, want 1", got)
+	}
+}
+
+func Test_mqManager_namespaces(t *testing.T) {
+	m := NewMQManager(MQManagerConfig{})
+	staging := Owner{AccountID: "user", Namespace: "staging"}
+	production := Owner{AccountID: "user", Namespace: "production"}
+	for _, owner := range []Owner{staging, production} {
+		if err := m.CreateQueue(owner, "orders", QueueAttributes{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.CreateQueue(staging, "orders-dlq", QueueAttributes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpdateQueueAttributes(production, "orders", func(attrs *QueueAttributes) error {
+		attrs.DeadLetter = &DeadLetterPolicy{Queue: "orders-dlq"}
+		return nil
+	}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("dead-letter queue of another namespace: error = %v, want ErrInvalidArgument", err)
+	}
+
+	mq, _ := m.GetQueue(staging, "orders")
+	if err := mq.Publish(&Message{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	mq, _ = m.GetQueue(production, "orders")
+	if got := mq.Stats().Messages; got != 0 {
+		t.Errorf("production messages = %v, want 0", got)
+	}
+	if _, err := m.GetQueue(Owner{AccountID: "user"}, "orders"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("default namespace: error = %v, want ErrQueueNotFound", err)
+	}
+	if got, _ := m.ListQueues(staging); len(got) != 2 {
+		t.Errorf("staging queues = %v, want 2", len(got))
+	}
+}
+
+func TestValidateQueueName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "orders_v2-EU", wantErr: false},
+		{name: strings.Repeat("a", MaxQueueNameLength), wantErr: false},
+		{name: "", wantErr: true},
+		{name: strings.Repeat("a", MaxQueueNameLength+1), wantErr: true},
+		{name: `quote"`, wantErr: true},
+		{name: `back\slash`, wantErr: true},
+		{name: "white space", wantErr: true},
+		{name: "ドメイン", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateQueueName(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("error = %v, want ErrInvalidArgument", err)
+			}
+		})
+	}
+}
+
+func Test_mqManager_deadLetterCycle(t *testing.T) {
+	owner := Owner{AccountID: "user"}
+	deadLetter := func(queue string) QueueAttributes {
+		return QueueAttributes{MaxLength: 1, Overflow: OverflowDeadLetter, DeadLetter: &DeadLetterPolicy{Queue: queue}}
+	}
+	m := NewMQManager(MQManagerConfig{})
+	if err := m.CreateQueue(owner, "c", QueueAttributes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateQueue(owner, "b", deadLetter("c")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateQueue(owner, "a", deadLetter("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"b", "c"} {
+		if err := m.UpdateQueueAttributes(owner, name, func(attrs *QueueAttributes) error {
+			*attrs = deadLetter("a")
+			return nil
+		}); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("dead-letter queue of %s back to a: error = %v, want ErrInvalidArgument", name, err)
+		}
+	}
+
+	// a queue named by a dead-letter policy can be deleted and created again
+	if err := m.DeleteQueue(owner, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpdateQueueAttributes(owner, "c", func(attrs *QueueAttributes) error {
+		*attrs = deadLetter("x")
+		return nil
+	}); err == nil {
+		t.Fatal("dead-letter queue which does not exist is resolved")
+	}
+	if err := m.CreateQueue(owner, "x", QueueAttributes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpdateQueueAttributes(owner, "c", func(attrs *QueueAttributes) error {
+		*attrs = deadLetter("x")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteQueue(owner, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateQueue(owner, "x", deadLetter("b")); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("create x with dead-letter queue b: error = %v, want ErrInvalidArgument", err)
+	}
+	if err := m.CreateQueue(owner, "x", QueueAttributes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// overflow goes down the chain
+	done := make(chan error, 1)
+	go func() {
+		b, _ := m.GetQueue(owner, "b")
+		for _, id := range []string{"1", "2", "3"} {
+			if err := b.Publish(&Message{ID: id}); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("publish to b does not return")
+	}
+	if u := m.Usage("user"); u.Messages != 3 {
+		t.Errorf("Usage().Messages = %v, want 3", u.Messages)
+	}
+}
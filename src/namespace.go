@@ -0,0 +1,42 @@
+package src
+
+import "context"
+
+// Owner is the scope queues are named in: an account and one of its namespaces.
+type Owner struct {
+	AccountID string
+	// Namespace isolates queues of the same account like AMQP virtual
+	// hosts. The empty namespace is the default one.
+	Namespace string
+}
+
+// String ...
+func (o Owner) String() string {
+	if o.Namespace == "" {
+		return o.AccountID
+	}
+	return o.AccountID + "@" + o.Namespace
+}
+
+// ValidateNamespace checks the namespace grammar, which is the one of
+// queue names. The empty namespace is valid.
+func ValidateNamespace(namespace string) error {
+	if namespace == "" {
+		return nil
+	}
+	return validateName("namespace", namespace, MaxQueueNameLength)
+}
+
+// namespaceKey ...
+type namespaceKey struct{}
+
+// WithNamespace ...
+func WithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, namespaceKey{}, namespace)
+}
+
+// NamespaceFromContext returns the namespace selected for the operation, or the default one.
+func NamespaceFromContext(ctx context.Context) string {
+	namespace, _ := ctx.Value(namespaceKey{}).(string)
+	return namespace
+}
@@ -0,0 +1,41 @@
+package src
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrForbidden is returned when the caller is not allowed to do an operation.
+var ErrForbidden = errors.New("forbidden")
+
+// Principal is the authenticated caller of an operation.
+type Principal struct {
+	AccountID string
+	Admin     bool
+	// Roles are matched by grants to roles.
+	Roles []string
+	// Scope limits the principal authenticated by a scoped API key or JWT.
+	Scope *APIKeyScope
+}
+
+// principalKey ...
+type principalKey struct{}
+
+// WithPrincipal ...
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext ...
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// requireAdmin ...
+func requireAdmin(ctx context.Context) error {
+	if p, ok := PrincipalFromContext(ctx); !ok || !p.Admin {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -6,12 +6,18 @@ import (
 	"sync"
 )
 
+// ErrQueueEmpty ...
+var ErrQueueEmpty = errors.New("queue is empty")
+
 // Queue ...
 type Queue[T any] interface {
 	Init()
 	Size() int64
 	Enqueue(T) error
 	Dequeue() (T, error)
+	Peek() (T, error)
+	Range(func(T) bool)
+	RemoveFunc(func(T) bool) []T
 }
 
 // NewQueue ...
@@ -57,9 +63,51 @@ func (q *queue[T]) Dequeue() (T, error) {
 
 	e := q.l.Front()
 	if e == nil {
-		return *new(T), errors.New("queue is empty")
+		return *new(T), ErrQueueEmpty
 	}
 
 	v := q.l.Remove(e)
 	return v.(T), nil
 }
+
+// Peek returns the value at the front without removing it.
+func (q *queue[T]) Peek() (T, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	e := q.l.Front()
+	if e == nil {
+		return *new(T), ErrQueueEmpty
+	}
+
+	return e.Value.(T), nil
+}
+
+// Range calls f for each value from the front while f returns true.
+func (q *queue[T]) Range(f func(T) bool) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	for e := q.l.Front(); e != nil; e = e.Next() {
+		if !f(e.Value.(T)) {
+			return
+		}
+	}
+}
+
+// RemoveFunc removes every value for which f returns true and returns them.
+func (q *queue[T]) RemoveFunc(f func(T) bool) []T {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	var removed []T
+	for e := q.l.Front(); e != nil; {
+		next := e.Next()
+		if v := e.Value.(T); f(v) {
+			q.l.Remove(e)
+			removed = append(removed, v)
+		}
+		e = next
+	}
+	return removed
+}
@@ -0,0 +1,235 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/verniyyy/verniy-mq/src/util"
+)
+
+// ErrInvalidArgument is returned for malformed or out of range input.
+var ErrInvalidArgument = errors.New("invalid argument")
+
+// QueueAttributes is the configuration of a queue given on creation.
+type QueueAttributes struct {
+	// ExpiresAfter is the idle period after which the queue is deleted
+	// automatically. Zero means the queue never expires.
+	ExpiresAfter util.Duration `json:"expires_after,omitempty"`
+
+	// VisibilityTimeout is how long a consumed message is hidden before it
+	// is returned to the queue. Defaults to 1 minute.
+	VisibilityTimeout util.Duration `json:"visibility_timeout,omitempty"`
+
+	// RetentionPeriod is how long a message is kept before it is dropped.
+	// Zero means messages are kept until consumed.
+	RetentionPeriod util.Duration `json:"retention_period,omitempty"`
+
+	// Delay is how long a published message is hidden before it is ready.
+	Delay util.Duration `json:"delay,omitempty"`
+
+	// MaxLength and MaxBytes limit the ready messages held by the queue.
+	// Zero means unlimited.
+	MaxLength int64 `json:"max_length,omitempty"`
+	MaxBytes  int64 `json:"max_bytes,omitempty"`
+
+	// Overflow is what happens to a publish exceeding the limits.
+	Overflow OverflowPolicy `json:"overflow,omitempty"`
+
+	// DeadLetter is where messages which can not be kept are moved to.
+	DeadLetter *DeadLetterPolicy `json:"dead_letter,omitempty"`
+
+	// PublishPaused and ConsumePaused stop producers and consumers of the queue.
+	PublishPaused bool `json:"publish_paused,omitempty"`
+	ConsumePaused bool `json:"consume_paused,omitempty"`
+
+	// Retry delays redelivery of messages returned by visibility expiry or NACK.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// RateLimit limits publishing and consuming on the queue, in addition
+	// to the rate limits of the account.
+	RateLimit *RateLimits `json:"rate_limit,omitempty"`
+
+	// Compression compresses the payloads of published messages while they
+	// are stored. Consumers get them as published.
+	Compression Codec `json:"compression,omitempty"`
+}
+
+// OverflowPolicy ...
+type OverflowPolicy string
+
+const (
+	// OverflowReject rejects the new message. This is the default.
+	OverflowReject OverflowPolicy = "reject"
+	// OverflowDropHead drops the oldest messages to make room.
+	OverflowDropHead OverflowPolicy = "drop-head"
+	// OverflowDeadLetter moves the oldest messages to the dead-letter queue to make room.
+	OverflowDeadLetter OverflowPolicy = "dead-letter"
+)
+
+// DeadLetterPolicy ...
+type DeadLetterPolicy struct {
+	// Queue is the name of the dead-letter queue in the same account.
+	Queue string `json:"queue"`
+
+	// MaxReceiveCount is how many times a message can be received before it
+	// is moved to the dead-letter queue instead of being returned. Zero
+	// means messages are only dead-lettered on overflow.
+	MaxReceiveCount int `json:"max_receive_count,omitempty"`
+}
+
+// RetryPolicy is an exponential backoff on the receive count of a message.
+type RetryPolicy struct {
+	// Base is the delay after the first receive.
+	Base util.Duration `json:"base"`
+	// Multiplier is the growth of the delay per receive. Defaults to 2.
+	Multiplier float64 `json:"multiplier,omitempty"`
+	// Max caps the delay. Zero caps it at the longest time.Duration only.
+	Max util.Duration `json:"max,omitempty"`
+	// Jitter is the fraction of the delay, between 0 and 1, which is randomly taken off.
+	Jitter float64 `json:"jitter,omitempty"`
+}
+
+// Delay is the delay before redelivering a message received receiveCount
+// times. rnd returns a random number in [0, 1).
+func (p RetryPolicy) Delay(receiveCount int, rnd func() float64) time.Duration {
+	if receiveCount < 1 || p.Base <= 0 {
+		return 0
+	}
+
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+
+	// without a cap, the delay grows past the longest duration
+	d := math.Min(float64(p.Base)*math.Pow(multiplier, float64(receiveCount-1)), math.MaxInt64)
+	if p.Max > 0 && d > float64(p.Max) {
+		d = float64(p.Max)
+	}
+	if p.Jitter > 0 {
+		d -= d * p.Jitter * rnd()
+	}
+
+	if d >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(d)
+}
+
+// validate ...
+func (p RetryPolicy) validate() error {
+	if p.Base < 0 {
+		return fmt.Errorf("retry.base must not be negative")
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return fmt.Errorf("retry.multiplier must be 1 or more")
+	}
+	if p.Max < 0 {
+		return fmt.Errorf("retry.max must not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("retry.jitter must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// DecodeQueueAttributes decodes JSON encoded attributes. Empty input gives the default attributes.
+func DecodeQueueAttributes(b []byte) (QueueAttributes, error) {
+	var attrs QueueAttributes
+	if len(b) == 0 {
+		return attrs, nil
+	}
+	if err := json.Unmarshal(b, &attrs); err != nil {
+		return QueueAttributes{}, fmt.Errorf("%w: invalid queue attributes: %v", ErrInvalidArgument, err)
+	}
+
+	return attrs, attrs.Validate()
+}
+
+// clone returns a copy of the attributes which shares no policy with them.
+func (a QueueAttributes) clone() QueueAttributes {
+	if a.DeadLetter != nil {
+		dl := *a.DeadLetter
+		a.DeadLetter = &dl
+	}
+	if a.Retry != nil {
+		retry := *a.Retry
+		a.Retry = &retry
+	}
+	if a.RateLimit != nil {
+		limit := *a.RateLimit
+		a.RateLimit = &limit
+	}
+	return a
+}
+
+// Validate ...
+func (a QueueAttributes) Validate() error {
+	if err := a.validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	return nil
+}
+
+// validate ...
+func (a QueueAttributes) validate() error {
+	if a.ExpiresAfter < 0 {
+		return fmt.Errorf("expires_after must not be negative")
+	}
+	if a.VisibilityTimeout < 0 {
+		return fmt.Errorf("visibility_timeout must not be negative")
+	}
+	if a.RetentionPeriod < 0 {
+		return fmt.Errorf("retention_period must not be negative")
+	}
+	if a.Delay < 0 {
+		return fmt.Errorf("delay must not be negative")
+	}
+	if a.MaxLength < 0 {
+		return fmt.Errorf("max_length must not be negative")
+	}
+	if a.MaxBytes < 0 {
+		return fmt.Errorf("max_bytes must not be negative")
+	}
+
+	switch a.Overflow {
+	case "", OverflowReject, OverflowDropHead:
+	case OverflowDeadLetter:
+		if a.DeadLetter == nil {
+			return fmt.Errorf("overflow \"%s\" requires dead_letter", a.Overflow)
+		}
+	default:
+		return fmt.Errorf("invalid overflow: \"%s\"", a.Overflow)
+	}
+
+	if a.DeadLetter != nil {
+		if a.DeadLetter.Queue == "" {
+			return fmt.Errorf("dead_letter.queue is required")
+		}
+		if a.DeadLetter.MaxReceiveCount < 0 {
+			return fmt.Errorf("dead_letter.max_receive_count must not be negative")
+		}
+	}
+
+	if a.Retry != nil {
+		if err := a.Retry.validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := a.Compression.validate(); err != nil {
+		return err
+	}
+
+	if a.RateLimit != nil {
+		if err := a.RateLimit.validate("rate_limit"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package src
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/verniyyy/verniy-mq/src/util"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       RetryPolicy
+		receiveCount int
+		rnd          float64
+		want         time.Duration
+	}{
+		{
+			name:         "no delay before the first receive",
+			policy:       RetryPolicy{Base: util.Duration(time.Second)},
+			receiveCount: 0,
+			want:         0,
+		},
+		{
+			name:         "base delay after the first receive",
+			policy:       RetryPolicy{Base: util.Duration(time.Second)},
+			receiveCount: 1,
+			want:         time.Second,
+		},
+		{
+			name:         "grows by the default multiplier",
+			policy:       RetryPolicy{Base: util.Duration(time.Second)},
+			receiveCount: 4,
+			want:         8 * time.Second,
+		},
+		{
+			name:         "grows by the multiplier",
+			policy:       RetryPolicy{Base: util.Duration(time.Second), Multiplier: 3},
+			receiveCount: 3,
+			want:         9 * time.Second,
+		},
+		{
+			name:         "capped by max",
+			policy:       RetryPolicy{Base: util.Duration(time.Second), Max: util.Duration(5 * time.Second)},
+			receiveCount: 10,
+			want:         5 * time.Second,
+		},
+		{
+			name:         "longest duration without max",
+			policy:       RetryPolicy{Base: util.Duration(time.Second)},
+			receiveCount: 100,
+			want:         math.MaxInt64,
+		},
+		{
+			name:         "longest duration when the growth overflows",
+			policy:       RetryPolicy{Base: util.Duration(time.Second), Multiplier: 10},
+			receiveCount: 1000,
+			want:         math.MaxInt64,
+		},
+		{
+			name:         "jitter takes off the longest duration",
+			policy:       RetryPolicy{Base: util.Duration(time.Second), Multiplier: 10, Jitter: 0.5},
+			receiveCount: 1000,
+			rnd:          1,
+			want:         1 << 62,
+		},
+		{
+			name:         "jitter takes off a fraction",
+			policy:       RetryPolicy{Base: util.Duration(time.Second), Jitter: 0.5},
+			receiveCount: 2,
+			rnd:          0.5,
+			want:         1500 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.Delay(tt.receiveCount, func() float64 { return tt.rnd })
+			if got != tt.want {
+				t.Errorf("Delay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// ErrQuotaExceeded is returned when an operation would take an account
+// over its quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota limits what an account holds over all its namespaces. Zero fields
+// are unlimited.
+type Quota struct {
+	MaxQueues int `json:"max_queues,omitempty"`
+	// MaxMessages and MaxBytes limit the messages held by the queues,
+	// ready, delayed and in flight.
+	MaxMessages    int64 `json:"max_messages,omitempty"`
+	MaxBytes       int64 `json:"max_bytes,omitempty"`
+	MaxMessageSize int64 `json:"max_message_size,omitempty"`
+}
+
+// DecodeQuota ...
+func DecodeQuota(b []byte) (Quota, error) {
+	var q Quota
+	if err := json.Unmarshal(b, &q); err != nil {
+		return Quota{}, fmt.Errorf("%w: invalid quota: %v", ErrInvalidArgument, err)
+	}
+	return q, q.Validate()
+}
+
+// Validate ...
+func (q Quota) Validate() error {
+	if q.MaxQueues < 0 || q.MaxMessages < 0 || q.MaxBytes < 0 || q.MaxMessageSize < 0 {
+		return fmt.Errorf("%w: quota limits must not be negative", ErrInvalidArgument)
+	}
+	return nil
+}
+
+// QuotaSource returns the quota of an account.
+type QuotaSource func(accountID string) Quota
+
+// QuotaUsage is what an account holds over all its namespaces.
+type QuotaUsage struct {
+	Queues   int   `json:"queues"`
+	Messages int64 `json:"messages"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// usageCounter keeps the usage of an account up to date as its queues
+// take and give up messages, so it is read without going over the queues.
+type usageCounter struct {
+	queues   atomic.Int64
+	messages atomic.Int64
+	bytes    atomic.Int64
+}
+
+// add ...
+func (c *usageCounter) add(messages, bytes int64) {
+	if c == nil {
+		return
+	}
+	c.messages.Add(messages)
+	c.bytes.Add(bytes)
+}
+
+// usage ...
+func (c *usageCounter) usage() QuotaUsage {
+	return QuotaUsage{
+		Queues:   int(c.queues.Load()),
+		Messages: c.messages.Load(),
+		Bytes:    c.bytes.Load(),
+	}
+}
+
+// checkPublish checks that a message of size, taking storedSize once
+// stored, can be added to usage.
+func (q Quota) checkPublish(accountID string, usage QuotaUsage, size, storedSize int64) error {
+	switch {
+	case q.MaxMessageSize > 0 && size > q.MaxMessageSize:
+		return fmt.Errorf("%w: message of %d bytes is larger than max message size %d of account \"%s\"", ErrQuotaExceeded, size, q.MaxMessageSize, accountID)
+	case q.MaxMessages > 0 && usage.Messages+1 > q.MaxMessages:
+		return fmt.Errorf("%w: account \"%s\" has reached max messages %d", ErrQuotaExceeded, accountID, q.MaxMessages)
+	case q.MaxBytes > 0 && usage.Bytes+storedSize > q.MaxBytes:
+		return fmt.Errorf("%w: account \"%s\" has reached max bytes %d", ErrQuotaExceeded, accountID, q.MaxBytes)
+	default:
+		return nil
+	}
+}
+
+// SetQuota sets the quota of an account. Nil resets it to the default quota.
+func (s *AccountStore) SetQuota(accountID string, quota *Quota) error {
+	if quota != nil {
+		if err := quota.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return s.update(func(accounts map[string]Account) error {
+		account, ok := accounts[accountID]
+		if !ok {
+			return fmt.Errorf("%w: account ID \"%s\"", ErrAccountNotFound, accountID)
+		}
+		account.Quota = quota
+		account.UpdatedAt = time.Now()
+		accounts[accountID] = account
+		return nil
+	})
+}
+
+// QuotaSource returns the quotas of the accounts, defaultQuota for the ones
+// without a quota or not in the store.
+func (s *AccountStore) QuotaSource(defaultQuota Quota) QuotaSource {
+	return func(accountID string) Quota {
+		if q := s.quota(accountID); q != nil {
+			return *q
+		}
+		return defaultQuota
+	}
+}
+
+// quotaCheckInterval is how often the quotas look for changes of the file,
+// so publishing does not stat it each time. Changes made by the store
+// itself are seen at once.
+const quotaCheckInterval = time.Second
+
+// quota returns the quota of an account, nil if it has none.
+func (s *AccountStore) quota(accountID string) *Quota {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.quotaCheckedAt) >= quotaCheckInterval {
+		if err := s.reload(); err != nil {
+			log.Printf("account store: %v\n", err)
+		}
+		s.quotaCheckedAt = time.Now()
+	}
+	return s.accounts[accountID].Quota
+}
@@ -0,0 +1,207 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/verniyyy/verniy-mq/src/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestQuota_checkPublish(t *testing.T) {
+	q := Quota{MaxMessages: 10, MaxBytes: 100, MaxMessageSize: 20}
+	tests := []struct {
+		name       string
+		usage      QuotaUsage
+		size       int64
+		storedSize int64
+		wantErr    bool
+	}{
+		{name: "within quota", usage: QuotaUsage{Messages: 9, Bytes: 80}, size: 20, storedSize: 20},
+		{name: "message too large", size: 21, storedSize: 5, wantErr: true},
+		{name: "max messages", usage: QuotaUsage{Messages: 10}, size: 1, storedSize: 1, wantErr: true},
+		{name: "max bytes", usage: QuotaUsage{Messages: 1, Bytes: 90}, size: 11, storedSize: 11, wantErr: true},
+		{name: "max bytes of the stored size", usage: QuotaUsage{Messages: 1, Bytes: 90}, size: 20, storedSize: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := q.checkPublish("user", tt.usage, tt.size, tt.storedSize)
+			if got := errors.Is(err, ErrQuotaExceeded); got != tt.wantErr {
+				t.Errorf("checkPublish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_mqManager_queueQuota(t *testing.T) {
+	m := NewMQManager(MQManagerConfig{
+		Quotas: func(accountID string) Quota { return Quota{MaxQueues: 2} },
+	})
+	// the quota counts the queues of every namespace
+	for _, owner := range []Owner{{AccountID: "user"}, {AccountID: "user", Namespace: "dev"}} {
+		if err := m.CreateQueue(owner, "q", QueueAttributes{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.CreateQueue(Owner{AccountID: "user"}, "other", QueueAttributes{}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("CreateQueue() error = %v, want ErrQuotaExceeded", err)
+	}
+	if err := m.CreateQueue(Owner{AccountID: "another"}, "q", QueueAttributes{}); err != nil {
+		t.Errorf("CreateQueue() error = %v", err)
+	}
+	if got := m.Usage("user").Queues; got != 2 {
+		t.Errorf("Usage().Queues = %v, want 2", got)
+	}
+}
+
+func Test_mqManager_Usage(t *testing.T) {
+	m := NewMQManager(MQManagerConfig{})
+	owner := Owner{AccountID: "user"}
+	for _, name := range []string{"a", "b"} {
+		if err := m.CreateQueue(owner, name, QueueAttributes{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.CreateQueue(Owner{AccountID: "user", Namespace: "dev"}, "delayed", QueueAttributes{Delay: util.Duration(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	publish := func(owner Owner, name, data string) {
+		t.Helper()
+		mq, err := m.GetQueue(owner, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := NewMessage(util.GenULID, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := mq.Publish(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(step string, want QuotaUsage) {
+		t.Helper()
+		if got := m.Usage("user"); got != want {
+			t.Errorf("%s: Usage() = %+v, want %+v", step, got, want)
+		}
+	}
+
+	publish(owner, "a", "hello")
+	publish(owner, "a", "world!")
+	publish(owner, "b", "x")
+	publish(Owner{AccountID: "user", Namespace: "dev"}, "delayed", "later")
+	check("publish", QuotaUsage{Queues: 3, Messages: 4, Bytes: 17})
+
+	// in-flight messages are held until they are deleted
+	a, _ := m.GetQueue(owner, "a")
+	msg, err := a.Consume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("consume", QuotaUsage{Queues: 3, Messages: 4, Bytes: 17})
+	if err := a.Delete(msg.ID); err != nil {
+		t.Fatal(err)
+	}
+	check("delete", QuotaUsage{Queues: 3, Messages: 3, Bytes: 12})
+
+	if err := m.RenameQueue(owner, "a", "c"); err != nil {
+		t.Fatal(err)
+	}
+	check("rename", QuotaUsage{Queues: 3, Messages: 3, Bytes: 12})
+
+	if err := m.TransferQueue(owner, "b", "another"); err != nil {
+		t.Fatal(err)
+	}
+	check("transfer", QuotaUsage{Queues: 2, Messages: 2, Bytes: 11})
+	if got, want := m.Usage("another"), (QuotaUsage{Queues: 1, Messages: 1, Bytes: 1}); got != want {
+		t.Errorf("transfer: Usage() of the new account = %+v, want %+v", got, want)
+	}
+
+	if err := m.DeleteQueue(Owner{AccountID: "user", Namespace: "dev"}, "delayed"); err != nil {
+		t.Fatal(err)
+	}
+	check("delete queue", QuotaUsage{Queues: 1, Messages: 1, Bytes: 6})
+
+	c, _ := m.GetQueue(owner, "c")
+	c.Purge()
+	check("purge", QuotaUsage{Queues: 1})
+
+	if got := m.Usage("nobody"); got != (QuotaUsage{}) {
+		t.Errorf("Usage() of an account without queues = %+v", got)
+	}
+}
+
+func TestMessageQueueApplication_Publish_quota(t *testing.T) {
+	m := NewMQManager(MQManagerConfig{
+		Quotas: func(accountID string) Quota { return Quota{MaxBytes: 100} },
+	})
+	owner := Owner{AccountID: "user"}
+	if err := m.CreateQueue(owner, "orders", QueueAttributes{Compression: CodecGzip}); err != nil {
+		t.Fatal(err)
+	}
+	app := NewMessageQueueApplication(m, nil)
+	ctx := WithPrincipal(context.Background(), Principal{AccountID: "user"})
+
+	// the quota counts messages as stored, compressed by the queue
+	if _, err := app.Publish(ctx, "user", "orders", make([]byte, 1000)); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	usage := m.Usage("user")
+	if usage.Messages != 1 || usage.Bytes <= 0 || usage.Bytes >= 100 {
+		t.Errorf("Usage() = %+v, want one message of its compressed size", usage)
+	}
+	random := make([]byte, 200)
+	rand.New(rand.NewSource(1)).Read(random)
+	if _, err := app.Publish(ctx, "user", "orders", random); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Publish() error = %v, want ErrQuotaExceeded", err)
+	}
+}
+
+func TestAccountStore_QuotaSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), AccountsFileName)
+	s, err := NewAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cost = bcrypt.MinCost
+	if err := s.Add("alice", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	defaultQuota := Quota{MaxQueues: 1}
+	quotas := s.QuotaSource(defaultQuota)
+	if got := quotas("alice"); got != defaultQuota {
+		t.Errorf("quota = %+v, want the default quota", got)
+	}
+
+	// changes of the store are seen at once
+	if err := s.SetQuota("alice", &Quota{MaxQueues: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := quotas("alice"); got.MaxQueues != 2 {
+		t.Errorf("quota after SetQuota = %+v, want max queues 2", got)
+	}
+
+	// changes of another process are seen once the file is checked again
+	cli, err := NewAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.SetQuota("alice", &Quota{MaxQueues: 3}); err != nil {
+		t.Fatal(err)
+	}
+	s.quotaCheckedAt = time.Now()
+	if got := quotas("alice"); got.MaxQueues != 2 {
+		t.Errorf("quota before the check = %+v, want max queues 2", got)
+	}
+	s.quotaCheckedAt = time.Time{}
+	if got := quotas("alice"); got.MaxQueues != 3 {
+		t.Errorf("quota after the check = %+v, want max queues 3", got)
+	}
+	if got := quotas("nobody"); got != defaultQuota {
+		t.Errorf("quota of an unknown account = %+v, want the default quota", got)
+	}
+}
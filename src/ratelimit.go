@@ -0,0 +1,208 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrThrottled is returned when an operation goes over a rate limit.
+var ErrThrottled = errors.New("throttled")
+
+// ThrottledError is ErrThrottled with how long to wait before retrying.
+type ThrottledError struct {
+	// Limit describes the rate limit which was hit.
+	Limit      string
+	RetryAfter time.Duration
+}
+
+// Error ...
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%v: %s, retry after %v", ErrThrottled, e.Limit, e.RetryAfter)
+}
+
+// Unwrap ...
+func (e *ThrottledError) Unwrap() error {
+	return ErrThrottled
+}
+
+// RetryAfter returns how long to wait before retrying when err is a ThrottledError.
+func RetryAfter(err error) (time.Duration, bool) {
+	var t *ThrottledError
+	if !errors.As(err, &t) {
+		return 0, false
+	}
+	return t.RetryAfter, true
+}
+
+// RateLimit is a token bucket refilled at Rate operations per second up to
+// Burst operations. Zero rate is unlimited.
+type RateLimit struct {
+	Rate float64 `json:"rate"`
+	// Burst defaults to the rate rounded up.
+	Burst int `json:"burst,omitempty"`
+}
+
+// burst ...
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, math.Ceil(l.Rate))
+}
+
+// validate ...
+func (l RateLimit) validate(name string) error {
+	if l.Rate < 0 || math.IsNaN(l.Rate) || math.IsInf(l.Rate, 0) {
+		return fmt.Errorf("%s.rate must not be negative", name)
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("%s.burst must not be negative", name)
+	}
+	return nil
+}
+
+// RateLimits are the rate limits of publishing and consuming messages.
+type RateLimits struct {
+	Publish RateLimit `json:"publish"`
+	Consume RateLimit `json:"consume"`
+}
+
+// Validate ...
+func (l RateLimits) Validate() error {
+	if err := l.validate("rate_limit"); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	return nil
+}
+
+// validate ...
+func (l RateLimits) validate(name string) error {
+	if err := l.Publish.validate(name + ".publish"); err != nil {
+		return err
+	}
+	return l.Consume.validate(name + ".consume")
+}
+
+// limit returns the rate limit of op, unlimited for other operations
+// than publishing and consuming.
+func (l RateLimits) limit(op Permission) RateLimit {
+	switch op {
+	case PermissionPublish:
+		return l.Publish
+	case PermissionConsume:
+		return l.Consume
+	default:
+		return RateLimit{}
+	}
+}
+
+// rateLimitSweepInterval is how often full buckets are dropped, which are
+// the same as new ones.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter holds the token buckets of the rate limits.
+type rateLimiter struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*tokenBucket
+	lastSweep time.Time
+}
+
+// bucketKey is the operation and the account ID or the queue of a bucket.
+type bucketKey struct {
+	op Permission
+	id any
+}
+
+// tokenBucket ...
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+// rateLimitRequest is a token to take from the bucket of id under limit.
+type rateLimitRequest struct {
+	id    any
+	limit RateLimit
+	// name describes the limit in errors.
+	name string
+}
+
+// newRateLimiter ...
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		now:     time.Now,
+		buckets: make(map[bucketKey]*tokenBucket),
+	}
+}
+
+// take takes a token for op from the bucket of every request, or from none
+// of them when one is empty.
+func (l *rateLimiter) take(op Permission, reqs ...rateLimitRequest) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	buckets := make([]*tokenBucket, 0, len(reqs))
+	var throttled *ThrottledError
+	for _, req := range reqs {
+		if req.limit.Rate == 0 {
+			continue
+		}
+		k := bucketKey{op: op, id: req.id}
+		b, ok := l.buckets[k]
+		if !ok {
+			b = &tokenBucket{limit: req.limit, tokens: req.limit.burst(), last: now}
+			l.buckets[k] = b
+		}
+		b.refill(req.limit, now)
+		if b.tokens < 1 {
+			// rounded up to milliseconds, the precision of the hints
+			wait := time.Duration(math.Ceil((1-b.tokens)/req.limit.Rate*1000)) * time.Millisecond
+			if throttled == nil || wait > throttled.RetryAfter {
+				throttled = &ThrottledError{Limit: req.name, RetryAfter: wait}
+			}
+		}
+		buckets = append(buckets, b)
+	}
+	if throttled != nil {
+		return throttled
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return nil
+}
+
+// sweep drops the full buckets every rateLimitSweepInterval. l.mu must be held.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for k, b := range l.buckets {
+		b.refill(b.limit, now)
+		if b.tokens >= b.limit.burst() {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// refill adds the tokens since the last refill, under limit which may
+// have been changed since.
+func (b *tokenBucket) refill(limit RateLimit, now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * limit.Rate
+		b.last = now
+	}
+	b.limit = limit
+	b.tokens = math.Min(b.tokens, limit.burst())
+}
@@ -0,0 +1,50 @@
+package src
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_rateLimiter_take(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter()
+	l.now = func() time.Time { return now }
+
+	account := rateLimitRequest{id: "user", limit: RateLimit{Rate: 1, Burst: 2}}
+	queue := rateLimitRequest{id: "queue", limit: RateLimit{Rate: 10, Burst: 1}}
+
+	tests := []struct {
+		name           string
+		elapsed        time.Duration
+		op             Permission
+		reqs           []rateLimitRequest
+		wantRetryAfter time.Duration
+	}{
+		{name: "burst", reqs: []rateLimitRequest{account, queue}},
+		{name: "queue empty", reqs: []rateLimitRequest{account, queue}, wantRetryAfter: 100 * time.Millisecond},
+		// the account token is not taken when the queue is throttled
+		{name: "burst left", elapsed: 100 * time.Millisecond, reqs: []rateLimitRequest{account, queue}},
+		{name: "account empty", reqs: []rateLimitRequest{account}, wantRetryAfter: 900 * time.Millisecond},
+		{name: "refilled", elapsed: 900 * time.Millisecond, reqs: []rateLimitRequest{account}},
+		{name: "other operation", op: PermissionConsume, reqs: []rateLimitRequest{{id: "user", limit: RateLimit{Rate: 1}}}},
+		{name: "unlimited", reqs: []rateLimitRequest{{id: "user"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.elapsed)
+			op := tt.op
+			if op == "" {
+				op = PermissionPublish
+			}
+			err := l.take(op, tt.reqs...)
+			retryAfter, ok := RetryAfter(err)
+			if ok != (tt.wantRetryAfter > 0) || retryAfter != tt.wantRetryAfter {
+				t.Errorf("take() error = %v, want retry after %v", err, tt.wantRetryAfter)
+			}
+			if ok && !errors.Is(err, ErrThrottled) {
+				t.Errorf("take() error = %v, want ErrThrottled", err)
+			}
+		})
+	}
+}
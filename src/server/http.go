@@ -1,9 +1,12 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -12,7 +15,7 @@ import (
 )
 
 // NewHTTPServer ...
-func NewHTTPServer(host string, port int, mqm src.MQManager) Server {
+func NewHTTPServer(host string, port int, mqm src.MQManager, cfg Config) Server {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
@@ -20,19 +23,59 @@ func NewHTTPServer(host string, port int, mqm src.MQManager) Server {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(principal(cfg))
 
-	h := newMQManagerHandler(mqm)
+	h := newMQManagerHandler(mqm, cfg.Audit)
+	mh := newMessageHandler(mqm, cfg.Audit, cfg.maxMessageSize(src.Quota{}))
+	ah := newAccountHandler(cfg.Accounts, cfg.Audit)
+
+	r.Get("/metrics", newMetricsHandler(mqm).ServeHTTP)
 
 	r.Route("/api/v1/vmq", func(r chi.Router) {
 		r.Post("/", h.Create)
 		r.Get("/", h.List)
+		r.Delete("/", h.DeleteByTags)
+		r.Post("/purge", h.PurgeByTags)
+		r.Get("/{queueName}", h.Get)
+		r.Patch("/{queueName}", h.Update)
 		r.Delete("/{queueName}", h.Delete)
+		r.Post("/{queueName}/purge", h.Purge)
+		r.Post("/{queueName}/pause", h.Pause)
+		r.Post("/{queueName}/resume", h.Resume)
+		r.Post("/{queueName}/rename", h.Rename)
+		r.Post("/{queueName}/transfer", h.Transfer)
+		r.Get("/{queueName}/messages", h.Browse)
+		r.Get("/{queueName}/tags", h.ListTags)
+		r.Post("/{queueName}/tags", h.Tag)
+		r.Delete("/{queueName}/tags", h.Untag)
+
+		r.Post("/{queueName}/messages", mh.Publish)
+		r.Post("/{queueName}/consume", mh.Consume)
+		r.Delete("/{queueName}/messages/{messageID}", mh.Delete)
+		r.Post("/{queueName}/messages/{messageID}/nack", mh.Nack)
+	})
+
+	r.Route("/api/v1/admin/accounts/{accountID}", func(r chi.Router) {
+		r.Get("/keys", ah.ListAPIKeys)
+		r.Post("/keys", ah.CreateAPIKey)
+		r.Delete("/keys/{keyID}", ah.RevokeAPIKey)
+		r.Put("/quota", ah.SetQuota)
+		r.Delete("/quota", ah.ResetQuota)
+	})
+
+	r.Get("/api/v1/account", h.AccountInfo)
+
+	r.Route("/api/v1/acl", func(r chi.Router) {
+		r.Get("/", h.ListGrants)
+		r.Post("/", h.Grant)
+		r.Delete("/", h.Revoke)
 	})
 
 	return httpServer{
 		router: r,
 		host:   host,
 		port:   fmt.Sprint(port),
+		tls:    cfg.TLS,
 	}
 }
 
@@ -41,13 +84,154 @@ type httpServer struct {
 	router *chi.Mux
 	host   string
 	port   string
+	tls    *tls.Config
 }
 
 // Run ...
 func (s httpServer) Run() {
-	addr := fmt.Sprintf("%s:%s", s.host, s.port)
-	log.Printf("listening on %s by http", addr)
-	if err := http.ListenAndServe(addr, s.router); err != nil {
+	srv := &http.Server{
+		Addr:      fmt.Sprintf("%s:%s", s.host, s.port),
+		Handler:   s.router,
+		TLSConfig: s.tls,
+	}
+	var err error
+	if s.tls != nil {
+		log.Printf("listening on %s by https", srv.Addr)
+		// the certificate comes from the TLS config
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("listening on %s by http", srv.Addr)
+		err = srv.ListenAndServe()
+	}
+	if err != nil {
 		log.Printf("Error: %v", err)
 	}
 }
+
+// namespaceHeader selects the namespace of the account a request works in.
+const namespaceHeader = "X-Vmq-Namespace"
+
+// principal authenticates the caller by the Authorization header and sets
+// it, the account the request works on and the namespace given by the
+// namespace header to the request context.
+//
+// The uid query parameter selects another account to work on the queues of,
+// which needs admin or a grant of that account.
+func principal(cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			namespace := r.Header.Get(namespaceHeader)
+			if err := src.ValidateNamespace(namespace); err != nil {
+				handlerHelper{}.ResponseError(w, badRequest(err))
+				return
+			}
+
+			ctx := src.WithAuditSource(r.Context(), src.AuditSource{
+				RemoteAddr: r.RemoteAddr,
+				RequestID:  middleware.GetReqID(r.Context()),
+			})
+			uid := r.URL.Query().Get("uid")
+			var p src.Principal
+			if authDisabled() {
+				p = disabledAuthPrincipal(cfg, r, uid)
+			} else {
+				account, scope, err := authenticateHTTP(cfg, r)
+				recordHTTPAuth(ctx, cfg.Audit, r, account, err)
+				if err != nil {
+					handlerHelper{}.ResponseError(w, err)
+					return
+				}
+				p = cfg.principal(account, scope)
+			}
+
+			// the application checks that the caller is allowed on the queues of uid
+			userID := p.AccountID
+			if uid != "" {
+				userID = uid
+			}
+
+			ctx = src.WithPrincipal(ctx, p)
+			ctx = context.WithValue(ctx, userIDKey{}, userID)
+			ctx = src.WithNamespace(ctx, namespace)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// disabledAuthPrincipal is the caller with DISABLE_AUTH: the account of the
+// Basic credentials whatever the password, as over TCP, or else uid. uid
+// alone never has admin rights.
+func disabledAuthPrincipal(cfg Config, r *http.Request, uid string) src.Principal {
+	if accountID, _, ok := r.BasicAuth(); ok {
+		return cfg.principal(src.Account{ID: accountID}, nil)
+	}
+	p := cfg.principal(src.Account{ID: uid}, nil)
+	p.Admin = false
+	return p
+}
+
+// authenticateHTTP checks the Basic credentials of r against the account
+// store, and Bearer credentials as a JWT or an API key. The scope of the
+// token or key is returned. Requests without credentials may authenticate
+// by their client certificate.
+func authenticateHTTP(cfg Config, r *http.Request) (src.Account, *src.APIKeyScope, error) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if strings.EqualFold(scheme, "Bearer") && src.LooksLikeJWT(token) {
+		if cfg.JWT == nil {
+			return src.Account{}, nil, fmt.Errorf("%w: JWTs are not enabled", src.ErrUnauthenticated)
+		}
+		return cfg.JWT.Verify(token)
+	}
+
+	if cfg.Accounts == nil {
+		return src.Account{}, nil, fmt.Errorf("%w: no account store", src.ErrUnauthenticated)
+	}
+	if accountID, password, ok := r.BasicAuth(); ok {
+		account, err := cfg.Accounts.Authenticate(accountID, password)
+		return account, nil, err
+	}
+	if strings.EqualFold(scheme, "Bearer") && token != "" {
+		account, key, err := cfg.Accounts.AuthenticateAPIKey(token)
+		if err != nil {
+			return src.Account{}, nil, err
+		}
+		return account, key.Scope, nil
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && cfg.CertAccounts {
+		account, err := cfg.certAccount(r.TLS)
+		return account, nil, err
+	}
+	return src.Account{}, nil, fmt.Errorf("%w: credentials are required", src.ErrUnauthenticated)
+}
+
+// recordHTTPAuth records the outcome of authenticating r.
+func recordHTTPAuth(ctx context.Context, audit *src.AuditLog, r *http.Request, account src.Account, err error) {
+	typ := src.AuditAuthSuccess
+	if err != nil {
+		typ = src.AuditAuthFailure
+	}
+	e := src.NewAuditEvent(ctx, typ, err)
+	e.Account = account.ID
+	if accountID, _, ok := r.BasicAuth(); ok && err != nil {
+		e.Account = accountID
+	}
+	scheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if scheme == "" && r.TLS != nil {
+		scheme = "certificate"
+	}
+	if e.Detail == "" {
+		e.Detail = "http scheme=" + scheme
+	} else {
+		e.Detail = fmt.Sprintf("http scheme=%s: %s", scheme, e.Detail)
+	}
+	audit.Record(e)
+}
+
+// userIDKey ...
+type userIDKey struct{}
+
+// requestUserID returns the account whose queues the request works on.
+func requestUserID(r *http.Request) string {
+	userID, _ := r.Context().Value(userIDKey{}).(string)
+	return userID
+}
@@ -2,8 +2,14 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/verniyyy/verniy-mq/src"
@@ -13,14 +19,32 @@ import (
 type MQManagerHandler interface {
 	Create(http.ResponseWriter, *http.Request)
 	List(http.ResponseWriter, *http.Request)
+	Get(http.ResponseWriter, *http.Request)
+	Update(http.ResponseWriter, *http.Request)
 	Delete(http.ResponseWriter, *http.Request)
+	Purge(http.ResponseWriter, *http.Request)
+	Browse(http.ResponseWriter, *http.Request)
+	Pause(http.ResponseWriter, *http.Request)
+	Resume(http.ResponseWriter, *http.Request)
+	Rename(http.ResponseWriter, *http.Request)
+	Transfer(http.ResponseWriter, *http.Request)
+	ListTags(http.ResponseWriter, *http.Request)
+	Tag(http.ResponseWriter, *http.Request)
+	Untag(http.ResponseWriter, *http.Request)
+	PurgeByTags(http.ResponseWriter, *http.Request)
+	DeleteByTags(http.ResponseWriter, *http.Request)
+	ListGrants(http.ResponseWriter, *http.Request)
+	Grant(http.ResponseWriter, *http.Request)
+	Revoke(http.ResponseWriter, *http.Request)
+	AccountInfo(http.ResponseWriter, *http.Request)
 }
 
 // newMQManagerHandler ...
-func newMQManagerHandler(mqm src.MQManager) MQManagerHandler {
+func newMQManagerHandler(mqm src.MQManager, audit *src.AuditLog) MQManagerHandler {
 	return mqManagerHandler{
 		handlerHelper: handlerHelper{},
 		mqManager:     mqm,
+		audit:         audit,
 	}
 }
 
@@ -28,17 +52,28 @@ func newMQManagerHandler(mqm src.MQManager) MQManagerHandler {
 type mqManagerHandler struct {
 	handlerHelper
 	mqManager src.MQManager
+	audit     *src.AuditLog
 }
 
 // Create ...
 func (h mqManagerHandler) Create(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("uid")
+	userID := requestUserID(r)
 	queueName := r.URL.Query().Get("qn")
 
-	app := src.NewMessageQueueApplication(h.mqManager)
-	if err := app.CreateQueue(r.Context(), userID, queueName); err != nil {
-		log.Print(err)
-		w.WriteHeader(http.StatusInternalServerError)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.ResponseError(w, badRequest(err))
+		return
+	}
+	attrs, err := src.DecodeQueueAttributes(body)
+	if err != nil {
+		h.ResponseError(w, badRequest(err))
+		return
+	}
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	if err := app.CreateQueue(r.Context(), userID, queueName, attrs); err != nil {
+		h.ResponseError(w, err)
 		return
 	}
 
@@ -47,28 +82,601 @@ func (h mqManagerHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 // List ...
 func (h mqManagerHandler) List(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("uid")
+	userID := requestUserID(r)
+
+	query := r.URL.Query()
+	in := src.ListQueuesInput{
+		Prefix:      query.Get("prefix"),
+		Order:       src.SortOrder(query.Get("order")),
+		NextToken:   query.Get("next_token"),
+		TagSelector: query.Get("selector"),
+	}
+	var err error
+	if v := query.Get("max_results"); v != "" {
+		if in.MaxResults, err = strconv.Atoi(v); err != nil {
+			h.ResponseError(w, badRequest(err))
+			return
+		}
+	}
+	if v := query.Get("stats"); v != "" {
+		if in.IncludeStats, err = strconv.ParseBool(v); err != nil {
+			h.ResponseError(w, badRequest(err))
+			return
+		}
+	}
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	out, err := app.ListQueues(r.Context(), userID, in)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, out)
+}
+
+// Get ...
+func (h mqManagerHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
 
-	app := src.NewMessageQueueApplication(h.mqManager)
-	out, err := app.ListQueues(r.Context(), userID)
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	out, err := app.GetQueueAttributes(r.Context(), userID, queueName)
 	if err != nil {
-		log.Print(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		h.ResponseError(w, err)
 		return
 	}
 
 	h.ResponseJSON(w, http.StatusOK, out)
 }
 
+// Update ...
+func (h mqManagerHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.ResponseError(w, badRequest(err))
+		return
+	}
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	if err := app.SetQueueAttributes(r.Context(), userID, queueName, body); err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, nil)
+}
+
 // Delete ...
 func (h mqManagerHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("uid")
+	userID := requestUserID(r)
 	queueName := chi.URLParam(r, "queueName")
 
-	app := src.NewMessageQueueApplication(h.mqManager)
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
 	if err := app.DeleteQueue(r.Context(), userID, queueName); err != nil {
-		log.Print(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, nil)
+}
+
+// Purge ...
+func (h mqManagerHandler) Purge(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	out, err := app.PurgeQueue(r.Context(), userID, queueName)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, out)
+}
+
+// Browse ...
+func (h mqManagerHandler) Browse(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
+
+	var in src.BrowseQueueInput
+	var err error
+	query := r.URL.Query()
+	if v := query.Get("offset"); v != "" {
+		if in.Offset, err = strconv.Atoi(v); err != nil {
+			h.ResponseError(w, badRequest(err))
+			return
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if in.Limit, err = strconv.Atoi(v); err != nil {
+			h.ResponseError(w, badRequest(err))
+			return
+		}
+	}
+	if v := query.Get("in_flight"); v != "" {
+		if in.IncludeInFlight, err = strconv.ParseBool(v); err != nil {
+			h.ResponseError(w, badRequest(err))
+			return
+		}
+	}
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	out, err := app.BrowseQueue(r.Context(), userID, queueName, in)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, out)
+}
+
+// Pause ...
+func (h mqManagerHandler) Pause(w http.ResponseWriter, r *http.Request) {
+	h.setPaused(w, r, true)
+}
+
+// Resume ...
+func (h mqManagerHandler) Resume(w http.ResponseWriter, r *http.Request) {
+	h.setPaused(w, r, false)
+}
+
+// setPaused ...
+func (h mqManagerHandler) setPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
+
+	var in src.PauseQueueInput
+	var err error
+	query := r.URL.Query()
+	if v := query.Get("publish"); v != "" {
+		if in.Publish, err = strconv.ParseBool(v); err != nil {
+			h.ResponseError(w, badRequest(err))
+			return
+		}
+	}
+	if v := query.Get("consume"); v != "" {
+		if in.Consume, err = strconv.ParseBool(v); err != nil {
+			h.ResponseError(w, badRequest(err))
+			return
+		}
+	}
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	if paused {
+		err = app.PauseQueue(r.Context(), userID, queueName, in)
+	} else {
+		err = app.ResumeQueue(r.Context(), userID, queueName, in)
+	}
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, nil)
+}
+
+// Rename ...
+func (h mqManagerHandler) Rename(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
+	newName := r.URL.Query().Get("to")
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	if err := app.RenameQueue(r.Context(), userID, queueName, newName); err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, nil)
+}
+
+// Transfer ...
+func (h mqManagerHandler) Transfer(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
+	newUserID := r.URL.Query().Get("to")
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	if err := app.TransferQueue(r.Context(), userID, queueName, newUserID); err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, nil)
+}
+
+// ListTags ...
+func (h mqManagerHandler) ListTags(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	out, err := app.ListQueueTags(r.Context(), userID, queueName)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, out)
+}
+
+// Tag ...
+func (h mqManagerHandler) Tag(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.ResponseError(w, badRequest(err))
+		return
+	}
+	tags, err := src.DecodeTags(body)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	if err := app.TagQueue(r.Context(), userID, queueName, tags); err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, nil)
+}
+
+// Untag ...
+func (h mqManagerHandler) Untag(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
+	keys := strings.Split(r.URL.Query().Get("keys"), ",")
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	if err := app.UntagQueue(r.Context(), userID, queueName, keys); err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, nil)
+}
+
+// ListGrants ...
+func (h mqManagerHandler) ListGrants(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	out, err := app.ListGrants(r.Context(), userID)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, out)
+}
+
+// Grant ...
+func (h mqManagerHandler) Grant(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.ResponseError(w, badRequest(err))
+		return
+	}
+	g, err := src.DecodeGrant(body)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	if err := app.GrantAccess(r.Context(), userID, g); err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, nil)
+}
+
+// Revoke ...
+func (h mqManagerHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	grantee := r.URL.Query().Get("grantee")
+	queue := r.URL.Query().Get("queue")
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	if err := app.RevokeAccess(r.Context(), userID, grantee, queue); err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, nil)
+}
+
+// PurgeByTags ...
+func (h mqManagerHandler) PurgeByTags(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	selector := r.URL.Query().Get("selector")
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	out, err := app.PurgeQueues(r.Context(), userID, selector)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, out)
+}
+
+// DeleteByTags ...
+func (h mqManagerHandler) DeleteByTags(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	selector := r.URL.Query().Get("selector")
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	out, err := app.DeleteQueues(r.Context(), userID, selector)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, out)
+}
+
+// AccountInfo ...
+func (h mqManagerHandler) AccountInfo(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	out, err := app.AccountInfo(r.Context(), userID)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, out)
+}
+
+// MessageHandler ...
+type MessageHandler interface {
+	Publish(http.ResponseWriter, *http.Request)
+	Consume(http.ResponseWriter, *http.Request)
+	Delete(http.ResponseWriter, *http.Request)
+	Nack(http.ResponseWriter, *http.Request)
+}
+
+// newMessageHandler ...
+func newMessageHandler(mqm src.MQManager, audit *src.AuditLog, maxMessageSize int64) MessageHandler {
+	return messageHandler{
+		handlerHelper:  handlerHelper{},
+		mqManager:      mqm,
+		audit:          audit,
+		maxMessageSize: maxMessageSize,
+	}
+}
+
+// messageHandler ...
+type messageHandler struct {
+	handlerHelper
+	mqManager src.MQManager
+	audit     *src.AuditLog
+	// maxMessageSize is how much of a publish body is read. The quota of
+	// the account is checked on publish.
+	maxMessageSize int64
+}
+
+// publishResponse ...
+type publishResponse struct {
+	ID string `json:"id"`
+}
+
+// Publish ...
+func (h messageHandler) Publish(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxMessageSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.ResponseError(w, fmt.Errorf("%w: message is larger than max message size %d", src.ErrInvalidArgument, tooLarge.Limit))
+		return
+	}
+	if err != nil {
+		h.ResponseError(w, badRequest(err))
+		return
+	}
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	id, err := app.Publish(r.Context(), userID, queueName, data)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, publishResponse{ID: id})
+}
+
+// Consume ...
+func (h messageHandler) Consume(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	m, err := app.Consume(r.Context(), userID, queueName)
+	if errors.Is(err, src.ErrQueueEmpty) {
+		h.ResponseJSON(w, http.StatusNoContent, nil)
+		return
+	}
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, m)
+}
+
+// Delete ...
+func (h messageHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
+	messageID := chi.URLParam(r, "messageID")
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	if err := app.Delete(r.Context(), userID, queueName, messageID); err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, nil)
+}
+
+// Nack ...
+func (h messageHandler) Nack(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	queueName := chi.URLParam(r, "queueName")
+	messageID := chi.URLParam(r, "messageID")
+
+	var delay time.Duration
+	var increment bool
+	var err error
+	query := r.URL.Query()
+	if v := query.Get("delay"); v != "" {
+		if delay, err = time.ParseDuration(v); err != nil {
+			h.ResponseError(w, badRequest(err))
+			return
+		}
+	}
+	if v := query.Get("increment"); v != "" {
+		if increment, err = strconv.ParseBool(v); err != nil {
+			h.ResponseError(w, badRequest(err))
+			return
+		}
+	}
+
+	app := src.NewMessageQueueApplication(h.mqManager, h.audit)
+	if err := app.Nack(r.Context(), userID, queueName, messageID, delay, increment); err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, nil)
+}
+
+// AccountHandler ...
+type AccountHandler interface {
+	CreateAPIKey(http.ResponseWriter, *http.Request)
+	ListAPIKeys(http.ResponseWriter, *http.Request)
+	RevokeAPIKey(http.ResponseWriter, *http.Request)
+	SetQuota(http.ResponseWriter, *http.Request)
+	ResetQuota(http.ResponseWriter, *http.Request)
+}
+
+// newAccountHandler ...
+func newAccountHandler(accounts *src.AccountStore, audit *src.AuditLog) AccountHandler {
+	return accountHandler{
+		handlerHelper: handlerHelper{},
+		accounts:      accounts,
+		audit:         audit,
+	}
+}
+
+// accountHandler ...
+type accountHandler struct {
+	handlerHelper
+	accounts *src.AccountStore
+	audit    *src.AuditLog
+}
+
+// CreateAPIKey ...
+func (h accountHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	accountID := chi.URLParam(r, "accountID")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.ResponseError(w, badRequest(err))
+		return
+	}
+	in, err := src.DecodeCreateAPIKeyInput(body)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	app := src.NewAccountApplication(h.accounts, h.audit)
+	out, err := app.CreateAPIKey(r.Context(), accountID, in)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusCreated, out)
+}
+
+// ListAPIKeys ...
+func (h accountHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	accountID := chi.URLParam(r, "accountID")
+
+	app := src.NewAccountApplication(h.accounts, h.audit)
+	out, err := app.ListAPIKeys(r.Context(), accountID)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, out)
+}
+
+// RevokeAPIKey ...
+func (h accountHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	accountID := chi.URLParam(r, "accountID")
+	keyID := chi.URLParam(r, "keyID")
+
+	app := src.NewAccountApplication(h.accounts, h.audit)
+	if err := app.RevokeAPIKey(r.Context(), accountID, keyID); err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, nil)
+}
+
+// SetQuota ...
+func (h accountHandler) SetQuota(w http.ResponseWriter, r *http.Request) {
+	accountID := chi.URLParam(r, "accountID")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.ResponseError(w, badRequest(err))
+		return
+	}
+	quota, err := src.DecodeQuota(body)
+	if err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	app := src.NewAccountApplication(h.accounts, h.audit)
+	if err := app.SetQuota(r.Context(), accountID, &quota); err != nil {
+		h.ResponseError(w, err)
+		return
+	}
+
+	h.ResponseJSON(w, http.StatusOK, nil)
+}
+
+// ResetQuota ...
+func (h accountHandler) ResetQuota(w http.ResponseWriter, r *http.Request) {
+	accountID := chi.URLParam(r, "accountID")
+
+	app := src.NewAccountApplication(h.accounts, h.audit)
+	if err := app.SetQuota(r.Context(), accountID, nil); err != nil {
+		h.ResponseError(w, err)
 		return
 	}
 
@@ -80,13 +688,67 @@ type handlerHelper struct{}
 
 // ResponseJSON ...
 func (h handlerHelper) ResponseJSON(w http.ResponseWriter, code int, payload any) {
-	w.WriteHeader(code)
 	if payload == nil {
+		w.WriteHeader(code)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	if err := json.NewEncoder(w).Encode(payload); err != nil {
 		panic(err)
 	}
 }
+
+// errorResponse ...
+type errorResponse struct {
+	Error string `json:"error"`
+	// RetryAfterMS is how long to wait before retrying a throttled request.
+	RetryAfterMS int64 `json:"retry_after_ms,omitempty"`
+}
+
+// ResponseError logs err and responds with the status code of it.
+func (h handlerHelper) ResponseError(w http.ResponseWriter, err error) {
+	log.Print(err)
+	status := errorStatus(err)
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="verniy-mq", Bearer realm="verniy-mq"`)
+	}
+	res := errorResponse{Error: err.Error()}
+	if retryAfter, ok := src.RetryAfter(err); ok {
+		res.RetryAfterMS = retryAfter.Milliseconds()
+		w.Header().Set("Retry-After", strconv.FormatInt(int64((retryAfter+time.Second-1)/time.Second), 10))
+	}
+	h.ResponseJSON(w, status, res)
+}
+
+// errBadRequest ...
+var errBadRequest = errors.New("bad request")
+
+// badRequest ...
+func badRequest(err error) error {
+	return fmt.Errorf("%w: %v", errBadRequest, err)
+}
+
+// errorStatus ...
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, errBadRequest), errors.Is(err, src.ErrInvalidArgument):
+		return http.StatusBadRequest
+	case errors.Is(err, src.ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, src.ErrForbidden), errors.Is(err, src.ErrQuotaExceeded):
+		return http.StatusForbidden
+	case errors.Is(err, src.ErrQueuePaused):
+		return http.StatusLocked
+	case errors.Is(err, src.ErrThrottled):
+		return http.StatusTooManyRequests
+	case errors.Is(err, src.ErrQueueNotFound), errors.Is(err, src.ErrAccountNotFound), errors.Is(err, src.ErrAPIKeyNotFound),
+		errors.Is(err, src.ErrMessageNotInFlight):
+		return http.StatusNotFound
+	case errors.Is(err, src.ErrQueueExists), errors.Is(err, src.ErrAccountExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
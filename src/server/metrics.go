@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/verniyyy/verniy-mq/src"
+)
+
+// metricsHandler serves queue statistics in the Prometheus text format.
+// Queue tags become labels prefixed with "tag_".
+type metricsHandler struct {
+	mqManager src.MQManager
+}
+
+// newMetricsHandler ...
+func newMetricsHandler(mqm src.MQManager) http.Handler {
+	return metricsHandler{mqManager: mqm}
+}
+
+// queueMetric ...
+type queueMetric struct {
+	name  string
+	help  string
+	kind  string
+	value func(src.QueueStats) int64
+}
+
+var queueMetrics = []queueMetric{
+	{"vmq_queue_messages", "Ready messages in the queue.", "gauge", func(s src.QueueStats) int64 { return s.Messages }},
+	{"vmq_queue_bytes", "Bytes of the ready messages in the queue.", "gauge", func(s src.QueueStats) int64 { return s.Bytes }},
+	{"vmq_queue_in_flight_messages", "Consumed messages waiting for delete.", "gauge", func(s src.QueueStats) int64 { return s.InFlightMessages }},
+	{"vmq_queue_delayed_messages", "Messages waiting for their delay.", "gauge", func(s src.QueueStats) int64 { return s.DelayedMessages }},
+	{"vmq_queue_published_total", "Messages published to the queue.", "counter", func(s src.QueueStats) int64 { return s.Published }},
+	{"vmq_queue_consumed_total", "Messages consumed from the queue.", "counter", func(s src.QueueStats) int64 { return s.Consumed }},
+	{"vmq_queue_deleted_total", "Messages deleted from the queue.", "counter", func(s src.QueueStats) int64 { return s.Deleted }},
+}
+
+// ServeHTTP serves the metrics of every account, so only admins can scrape them.
+func (h metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p, _ := src.PrincipalFromContext(r.Context()); !p.Admin && !authDisabled() {
+		handlerHelper{}.ResponseError(w, fmt.Errorf("%w: metrics are for admins", src.ErrForbidden))
+		return
+	}
+
+	entries := h.mqManager.Catalog()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Owner != entries[j].Owner {
+			return entries[i].Owner.String() < entries[j].Owner.String()
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	labels := make([]string, len(entries))
+	stats := make([]src.QueueStats, len(entries))
+	for i, e := range entries {
+		labels[i] = queueLabels(e)
+		stats[i] = e.Queue.Stats()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range queueMetrics {
+		writeMetricHeader(w, m.name, m.help, m.kind)
+		for i := range entries {
+			fmt.Fprintf(w, "%s{%s} %d\n", m.name, labels[i], m.value(stats[i]))
+		}
+	}
+
+	writeMetricHeader(w, "vmq_expired_queues_total", "Queues deleted for being idle.", "counter")
+	fmt.Fprintf(w, "vmq_expired_queues_total %d\n", h.mqManager.ExpiredQueues())
+}
+
+// writeMetricHeader ...
+func writeMetricHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// queueLabels ...
+func queueLabels(e src.QueueEntry) string {
+	keys := make([]string, 0, len(e.Tags))
+	for k := range e.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "account=%s,namespace=%s,queue=%s", labelValue(e.Owner.AccountID), labelValue(e.Owner.Namespace), labelValue(e.Name))
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		name := labelName("tag_" + k)
+		if seen[name] {
+			// keys differing only in replaced characters keep the first
+			continue
+		}
+		seen[name] = true
+		fmt.Fprintf(&b, ",%s=%s", name, labelValue(e.Tags[k]))
+	}
+	return b.String()
+}
+
+// labelName replaces the characters not allowed in a label name.
+func labelName(s string) string {
+	return strings.Map(func(c rune) rune {
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' {
+			return c
+		}
+		return '_'
+	}, s)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue quotes a label value.
+func labelValue(s string) string {
+	return `"` + labelValueReplacer.Replace(s) + `"`
+}
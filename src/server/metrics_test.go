@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/verniyyy/verniy-mq/src"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	h, mqm := newTestRouter(t, Config{})
+	owner := src.Owner{AccountID: "alice"}
+	if err := mqm.CreateQueue(owner, "orders", src.QueueAttributes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mqm.TagQueue(owner, "orders", map[string]string{"team": "pay\"ments", "cost-center": "42"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		account  string
+		wantCode int
+	}{
+		{name: "anonymous", account: "", wantCode: http.StatusUnauthorized},
+		{name: "account", account: "alice", wantCode: http.StatusForbidden},
+		{name: "admin", account: "root", wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := do(h, http.MethodGet, "/metrics", tt.account, "")
+			if res.Code != tt.wantCode {
+				t.Fatalf("GET /metrics = %d %s, want %d", res.Code, res.Body, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				if strings.Contains(res.Body.String(), "orders") {
+					t.Errorf("GET /metrics leaks queues: %s", res.Body)
+				}
+				return
+			}
+			want := `vmq_queue_messages{account="alice",namespace="",queue="orders",tag_cost_center="42",tag_team="pay\"ments"} 0`
+			if !strings.Contains(res.Body.String(), want) {
+				t.Errorf("GET /metrics = %s, want a line %s", res.Body, want)
+			}
+		})
+	}
+}
@@ -1,6 +1,91 @@
 package server
 
+import (
+	"crypto/tls"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/verniyyy/verniy-mq/src"
+)
+
 // Server ...
 type Server interface {
 	Run()
 }
+
+// Config is shared by the TCP and HTTP servers.
+type Config struct {
+	// AdminAccountIDs are the accounts allowed to do administrative operations.
+	AdminAccountIDs []string
+	// Accounts authenticates the clients.
+	Accounts *src.AccountStore
+	// JWT verifies bearer tokens of the identity provider. Nil disables JWTs.
+	JWT *src.JWTVerifier
+	// TLS secures both listeners. Nil listens in cleartext.
+	TLS *tls.Config
+	// CertAccounts authenticates clients with a verified certificate as the
+	// account named by its subject common name.
+	CertAccounts bool
+	// SessionLifetime is how long TCP sessions last until ReAuthCMD renews
+	// them. Zero never expires.
+	SessionLifetime time.Duration
+	// IdleTimeout closes TCP connections which send nothing for it. Zero
+	// never closes them.
+	IdleTimeout time.Duration
+	// Audit records security events. Nil records nothing.
+	Audit *src.AuditLog
+	// MaxMessageSize caps the size of published messages, after
+	// decompression, for every account. Zero is DefaultMaxMessageSize.
+	MaxMessageSize int64
+}
+
+// DefaultMaxMessageSize is the max message size of a server which does not
+// set one.
+const DefaultMaxMessageSize = 1 << 20
+
+// maxMessageSize is the size messages of an account of quota q are read and
+// decompressed up to, the smaller of the server and the account limits.
+func (c Config) maxMessageSize(q src.Quota) int64 {
+	limit := c.MaxMessageSize
+	if limit <= 0 {
+		limit = DefaultMaxMessageSize
+	}
+	if q.MaxMessageSize > 0 && q.MaxMessageSize < limit {
+		return q.MaxMessageSize
+	}
+	return limit
+}
+
+// isAdmin ...
+func (c Config) isAdmin(accountID string) bool {
+	for _, id := range c.AdminAccountIDs {
+		if id == accountID {
+			return true
+		}
+	}
+	return false
+}
+
+// principal returns the principal of an authenticated account limited to
+// scope, the one of its API key or token. Scoped principals do not have
+// admin rights.
+func (c Config) principal(account src.Account, scope *src.APIKeyScope) src.Principal {
+	p := src.Principal{
+		AccountID: account.ID,
+		Admin:     c.isAdmin(account.ID),
+		Roles:     account.Roles,
+	}
+	if scope != nil {
+		p.Admin = false
+		p.Scope = scope
+	}
+	return p
+}
+
+// authDisabled reports whether DISABLE_AUTH is set, which accepts any
+// credentials for local development.
+func authDisabled() bool {
+	disabled, _ := strconv.ParseBool(os.Getenv("DISABLE_AUTH"))
+	return disabled
+}
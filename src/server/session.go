@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/verniyyy/verniy-mq/src"
+	"github.com/verniyyy/verniy-mq/src/util"
+)
+
+const (
+	// DefaultSessionLifetime is how long a TCP session lasts before it has
+	// to be re-authenticated.
+	DefaultSessionLifetime = 12 * time.Hour
+	// DefaultIdleTimeout is how long a TCP connection may send nothing
+	// before it is closed.
+	DefaultIdleTimeout = 5 * time.Minute
+)
+
+// ErrSessionExpired is returned for commands of a session past its
+// lifetime, which ReAuthCMD renews.
+var ErrSessionExpired = errors.New("session expired, re-authenticate")
+
+// session is an authenticated TCP session.
+type session struct {
+	id        SessionID
+	accountID string
+	// ctx carries the principal and the namespace of the session.
+	ctx context.Context
+	// expiresAt is zero for sessions without a lifetime.
+	expiresAt time.Time
+	// codec compresses message payloads on the wire.
+	codec src.Codec
+}
+
+// newSession mints a session of the authenticated account on the
+// connection whose audit source is in ctx.
+func (h tcpHandler) newSession(ctx context.Context, account src.Account, scope *src.APIKeyScope, namespace string) session {
+	ctx = src.WithPrincipal(ctx, h.cfg.principal(account, scope))
+	s := session{
+		id:        NewSessionID(util.GenULID),
+		accountID: account.ID,
+		ctx:       src.WithNamespace(ctx, namespace),
+	}
+	if h.cfg.SessionLifetime > 0 {
+		s.expiresAt = time.Now().Add(h.cfg.SessionLifetime)
+	}
+	return s
+}
+
+// expired ...
+func (s session) expired(now time.Time) bool {
+	return !s.expiresAt.IsZero() && now.After(s.expiresAt)
+}
+
+// reauth authenticates the auth field and credential in body again and
+// returns a new session of the same account replacing s.
+func (h tcpHandler) reauth(ctx context.Context, s session, body []byte, state *tls.ConnectionState) (session, error) {
+	r := bytes.NewReader(body)
+	a, err := read[AuthField](r, authFieldSize)
+	if err != nil {
+		return session{}, fmt.Errorf("%w: invalid auth field: %v", src.ErrInvalidArgument, err)
+	}
+	credential, err := readBody(r, uint64(a.CredentialSize))
+	if err != nil {
+		return session{}, fmt.Errorf("%w: invalid credential: %v", src.ErrInvalidArgument, err)
+	}
+	account, scope, err := h.auth(a, credential, state)
+	if err == nil && account.ID != s.accountID {
+		err = fmt.Errorf("%w: session of account \"%s\" can not be renewed as account \"%s\"", src.ErrForbidden, s.accountID, account.ID)
+	}
+	h.recordAuth(ctx, a, account, err)
+	if err != nil {
+		return session{}, err
+	}
+	namespace := a.namespaceString()
+	if err := src.ValidateNamespace(namespace); err != nil {
+		return session{}, err
+	}
+	renewed := h.newSession(ctx, account, scope, namespace)
+	// the wire compression is the one negotiated by the connection
+	renewed.codec = s.codec
+	return renewed, nil
+}
+
+// recordAuth records the outcome of authenticating a on the connection
+// whose audit source is in ctx.
+func (h tcpHandler) recordAuth(ctx context.Context, a AuthField, account src.Account, err error) {
+	typ := src.AuditAuthSuccess
+	if err != nil {
+		typ = src.AuditAuthFailure
+	}
+	e := src.NewAuditEvent(ctx, typ, err)
+	e.Account = account.ID
+	if err != nil {
+		e.Account = a.accountIDString()
+	}
+	if e.Detail == "" {
+		e.Detail = fmt.Sprintf("tcp mechanism=%d", a.Mechanism)
+	} else {
+		e.Detail = fmt.Sprintf("tcp mechanism=%d: %s", a.Mechanism, e.Detail)
+	}
+	h.cfg.Audit.Record(e)
+}
+
+// setIdleDeadline closes conn when nothing is read from it for the idle timeout.
+func (h tcpHandler) setIdleDeadline(conn net.Conn) error {
+	if h.cfg.IdleTimeout <= 0 {
+		return nil
+	}
+	return conn.SetReadDeadline(time.Now().Add(h.cfg.IdleTimeout))
+}
+
+// isTimeout ...
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// skipBody discards the data following header so that the next header can
+// be read after a command is refused.
+func skipBody(r *bufio.Reader, header HeaderField) error {
+	size := int64(header.DataSize)
+	switch header.Command {
+	case DeleteCMD:
+		size = src.MessageIDSize
+	case NackCMD:
+		size = nackFieldSize
+	}
+	_, err := io.CopyN(io.Discard, r, size)
+	return err
+}
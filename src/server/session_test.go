@@ -0,0 +1,280 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/verniyyy/verniy-mq/src"
+)
+
+func TestTCPHandler_session(t *testing.T) {
+	const lifetime = 300 * time.Millisecond
+	c := newTestTCPClient(t, Config{SessionLifetime: lifetime})
+	c.handshake(t, newTestAuthField("alice", testPassword))
+
+	c.expect(t, PingCMD, "", nil, OK, "pong")
+	c.expect(t, CreateQueueCMD, "orders", []byte("{}"), OK, "")
+	time.Sleep(lifetime + 50*time.Millisecond)
+
+	// the bodies of refused commands are skipped, so the stream stays aligned
+	c.expect(t, PublishCMD, "orders", []byte("expired"), SessionExpired, ErrSessionExpired.Error())
+	c.expect(t, DeleteCMD, "orders", make([]byte, src.MessageIDSize), SessionExpired, ErrSessionExpired.Error())
+	c.expect(t, PingCMD, "", nil, SessionExpired, ErrSessionExpired.Error())
+
+	c.expect(t, ReAuthCMD, "", newTestAuthField("alice", "wrong password").bytes(t), Error, "")
+	c.expect(t, ReAuthCMD, "", newTestAuthField("bob", testPassword).bytes(t), Error, "")
+	c.expect(t, PingCMD, "", nil, SessionExpired, ErrSessionExpired.Error())
+
+	old := c.sid
+	_, data := c.do(t, ReAuthCMD, "", newTestAuthField("alice", testPassword).bytes(t))
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &c.sid); err != nil {
+		t.Fatalf("ReAuthCMD = %q: %v", data, err)
+	}
+	if c.sid == old {
+		t.Fatal("ReAuthCMD kept the session ID")
+	}
+
+	c.expect(t, PublishCMD, "orders", []byte("hello"), OK, "")
+	if result, data := c.do(t, ConsumeCMD, "orders", nil); result != OK || string(data[src.MessageIDSize:]) != "hello" {
+		t.Errorf("ConsumeCMD = %d %q, want the message published after re-auth", result, data)
+	}
+	if result, _ := c.do(t, ConsumeCMD, "orders", nil); result != Error {
+		t.Errorf("ConsumeCMD = %d, want an empty queue", result)
+	}
+
+	// the header of the expired session is refused and the connection closed
+	c.sid = old
+	c.expect(t, PingCMD, "", nil, Error, "invalid session id")
+	c.expectClosed(t)
+}
+
+func TestTCPHandler_idleTimeout(t *testing.T) {
+	c := newTestTCPClient(t, Config{IdleTimeout: 50 * time.Millisecond})
+	c.handshake(t, newTestAuthField("alice", testPassword))
+	c.expect(t, PingCMD, "", nil, OK, "pong")
+	c.expectClosed(t)
+}
+
+func TestTCPHandler_handshake(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        AuthField
+		wantAuth bool
+	}{
+		{name: "password", a: newTestAuthField("alice", testPassword), wantAuth: true},
+		{name: "wrong password", a: newTestAuthField("alice", "wrong password")},
+		{name: "unknown mechanism", a: func() AuthField { a := newTestAuthField("alice", testPassword); a.Mechanism = 9; return a }()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestTCPClient(t, Config{})
+			if !tt.wantAuth {
+				c.write(t, tt.a.bytes(t))
+				c.expectClosed(t)
+				return
+			}
+			c.handshake(t, tt.a)
+			c.expect(t, PingCMD, "", nil, OK, "pong")
+		})
+	}
+}
+
+func TestTCPHandler_publish(t *testing.T) {
+	const maxMessageSize = 1024
+	zeros := func(n int) []byte { return make([]byte, n) }
+
+	t.Run("larger than the buffer", func(t *testing.T) {
+		c := newTestTCPClient(t, Config{})
+		c.handshake(t, newTestAuthField("alice", testPassword))
+		c.expect(t, CreateQueueCMD, "orders", []byte("{}"), OK, "")
+
+		// bodies are read whole however the reads split them
+		data := bytes.Repeat([]byte("0123456789"), 1000)
+		c.expect(t, PublishCMD, "orders", data, OK, "")
+		if result, got := c.do(t, ConsumeCMD, "orders", nil); result != OK || !bytes.Equal(got[src.MessageIDSize:], data) {
+			t.Errorf("ConsumeCMD = %d with %d bytes, want the %d bytes published", result, len(got)-src.MessageIDSize, len(data))
+		}
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		c := newTestTCPClient(t, Config{MaxMessageSize: maxMessageSize})
+		a := newTestAuthField("alice", testPassword)
+		a.Compression = WireCompressionGzip
+		c.handshake(t, a)
+		c.expect(t, CreateQueueCMD, "orders", []byte("{}"), OK, "")
+
+		// the server max message size caps decompression without an account quota
+		c.expect(t, PublishCMD, "orders", gzipData(t, zeros(maxMessageSize+1)), Error, "")
+		c.expect(t, PublishCMD, "orders", zeros(maxMessageSize+1), Error, "")
+		c.expect(t, PingCMD, "", nil, OK, "pong")
+
+		c.expect(t, PublishCMD, "orders", gzipData(t, zeros(maxMessageSize)), OK, "")
+		result, got := c.do(t, ConsumeCMD, "orders", nil)
+		if result != OK {
+			t.Fatalf("ConsumeCMD = %d %q", result, got)
+		}
+		data, err := src.CodecGzip.Decode(got[src.MessageIDSize:], 0)
+		if err != nil || !bytes.Equal(data, zeros(maxMessageSize)) {
+			t.Errorf("ConsumeCMD data = %d bytes, %v, want the %d bytes published", len(data), err, maxMessageSize)
+		}
+		if result, _ := c.do(t, ConsumeCMD, "orders", nil); result != Error {
+			t.Errorf("ConsumeCMD = %d, want only the message within the limit published", result)
+		}
+	})
+}
+
+func TestTCPHandler_commandBodySize(t *testing.T) {
+	c := newTestTCPClient(t, Config{})
+	c.handshake(t, newTestAuthField("alice", testPassword))
+
+	// bodies over the limit are refused and skipped
+	c.expect(t, CreateQueueCMD, "orders", make([]byte, maxCommandBodySize+1), Error, "")
+	c.expect(t, PingCMD, "", nil, OK, "pong")
+	if result, _ := c.do(t, GetQueueAttributesCMD, "orders", nil); result != Error {
+		t.Errorf("GetQueueAttributesCMD = %d, want the queue not created", result)
+	}
+
+	// a size which can not be allocated is not, so the handler returns
+	// when the connection is closed instead of panicking
+	c.writeHeader(t, CreateQueueCMD, "orders", 1<<62)
+}
+
+// gzipData ...
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	b, err := src.CodecGzip.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// testTCPClient talks to a TCP handler over a pipe.
+type testTCPClient struct {
+	conn net.Conn
+	sid  SessionID
+}
+
+// newTestTCPClient serves one end of a pipe by a TCP handler of cfg with
+// the accounts of newTestRouter.
+func newTestTCPClient(t *testing.T, cfg Config) *testTCPClient {
+	t.Helper()
+	cfg.Accounts = newTestAccountStore(t, "root", "alice", "bob")
+	cfg.AdminAccountIDs = []string{"root"}
+	server, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		newTCPHandler(src.NewMQManager(src.MQManagerConfig{}), cfg).HandleRequest(server)
+	}()
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+	return &testTCPClient{conn: client}
+}
+
+// newTestAuthField ...
+func newTestAuthField(accountID, password string) AuthField {
+	var a AuthField
+	copy(a.AccountID[:], []rune(accountID))
+	copy(a.Password[:], []rune(password))
+	return a
+}
+
+// bytes encodes a as the body of ReAuthCMD.
+func (a AuthField) bytes(t *testing.T) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.BigEndian, a); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// handshake authenticates by a and keeps the session ID.
+func (c *testTCPClient) handshake(t *testing.T, a AuthField) {
+	t.Helper()
+	c.write(t, a.bytes(t))
+	if err := binary.Read(c.conn, binary.BigEndian, &c.sid); err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	var compression [1]byte
+	if _, err := io.ReadFull(c.conn, compression[:]); err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	if compression[0] != a.Compression {
+		t.Errorf("handshake compression = %d, want %d", compression[0], a.Compression)
+	}
+}
+
+// do sends a command with body and returns the result and data of the response.
+func (c *testTCPClient) do(t *testing.T, cmd uint8, queueName string, body []byte) (uint8, []byte) {
+	t.Helper()
+	c.writeHeader(t, cmd, queueName, uint64(len(body)))
+	if len(body) > 0 {
+		c.write(t, body)
+	}
+
+	var res struct {
+		Result   uint8
+		DataSize uint64
+	}
+	if err := binary.Read(c.conn, binary.BigEndian, &res); err != nil {
+		t.Fatalf("command %d: %v", cmd, err)
+	}
+	data := make([]byte, res.DataSize)
+	if _, err := io.ReadFull(c.conn, data); err != nil {
+		t.Fatalf("command %d: %v", cmd, err)
+	}
+	return res.Result, data
+}
+
+// writeHeader sends the header of a command with a body of size.
+func (c *testTCPClient) writeHeader(t *testing.T, cmd uint8, queueName string, size uint64) {
+	t.Helper()
+	h := HeaderField{SessionID: c.sid, Command: cmd, DataSize: size}
+	copy(h.QueueName[:], []rune(queueName))
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.BigEndian, h); err != nil {
+		t.Fatal(err)
+	}
+	c.write(t, buf.Bytes())
+}
+
+// expect sends a command and checks the result of the response, and its
+// data unless wantData is empty.
+func (c *testTCPClient) expect(t *testing.T, cmd uint8, queueName string, body []byte, wantResult uint8, wantData string) {
+	t.Helper()
+	result, data := c.do(t, cmd, queueName, body)
+	if result != wantResult || (wantData != "" && string(data) != wantData) {
+		t.Errorf("command %d = %d %q, want %d %q", cmd, result, data, wantResult, wantData)
+	}
+}
+
+// write ...
+func (c *testTCPClient) write(t *testing.T, p []byte) {
+	t.Helper()
+	if err := c.conn.SetWriteDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.conn.Write(p); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+// expectClosed waits for the handler to close the connection.
+func (c *testTCPClient) expectClosed(t *testing.T) {
+	t.Helper()
+	// setting the deadline fails once the handler has closed its end
+	if err := c.conn.SetReadDeadline(time.Now().Add(time.Second)); err == io.ErrClosedPipe {
+		return
+	}
+	if _, err := c.conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read = %v, want the connection closed", err)
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
@@ -9,11 +10,12 @@ import (
 )
 
 // NewTCPServer ...
-func NewTCPServer(host string, port int, mqm src.MQManager) Server {
+func NewTCPServer(host string, port int, mqm src.MQManager, cfg Config) Server {
 	return tcpServer{
 		host:    host,
 		port:    fmt.Sprint(port),
-		handler: newTCPHandler(mqm),
+		handler: newTCPHandler(mqm, cfg),
+		tls:     cfg.TLS,
 	}
 }
 
@@ -22,6 +24,7 @@ type tcpServer struct {
 	host    string
 	port    string
 	handler TCPHandler
+	tls     *tls.Config
 }
 
 // Run ...
@@ -31,8 +34,11 @@ func (s tcpServer) Run() {
 		log.Fatal(err)
 	}
 	defer listener.Close()
+	if s.tls != nil {
+		listener = tls.NewListener(listener, s.tls)
+	}
 
-	log.Printf("listening on %s:%s by tcp", s.host, s.port)
+	log.Printf("listening on %s:%s by tcp (tls: %v)", s.host, s.port, s.tls != nil)
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
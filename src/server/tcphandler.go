@@ -4,14 +4,16 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
-	"os"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/verniyyy/verniy-mq/src"
 	"github.com/verniyyy/verniy-mq/src/util"
@@ -27,12 +29,37 @@ const (
 	PublishCMD
 	ConsumeCMD
 	DeleteCMD
+	NackCMD
+	PurgeQueueCMD
+	BrowseQueueCMD
+	GetQueueAttributesCMD
+	SetQueueAttributesCMD
+	PauseQueueCMD
+	ResumeQueueCMD
+	RenameQueueCMD
+	TransferQueueCMD
+	TagQueueCMD
+	UntagQueueCMD
+	ListQueueTagsCMD
+	PurgeQueuesCMD
+	DeleteQueuesCMD
+	GrantAccessCMD
+	RevokeAccessCMD
+	ListGrantsCMD
+	ReAuthCMD
+	AccountInfoCMD
 )
 
 const (
 	_ uint8 = iota
 	OK
 	Error
+	Paused
+	// SessionExpired answers every command but ReAuthCMD of an expired session.
+	SessionExpired
+	// Throttled answers commands over a rate limit. The data starts with
+	// the milliseconds to wait before retrying as a uint32.
+	Throttled
 )
 
 // TCPHandler ...
@@ -41,15 +68,17 @@ type TCPHandler interface {
 }
 
 // newTCPHandler ...
-func newTCPHandler(mqm src.MQManager) TCPHandler {
+func newTCPHandler(mqm src.MQManager, cfg Config) TCPHandler {
 	return tcpHandler{
 		mqManager: mqm,
+		cfg:       cfg,
 	}
 }
 
 // tcpHandler ...
 type tcpHandler struct {
 	mqManager src.MQManager
+	cfg       Config
 }
 
 // HandleRequest ...
@@ -67,27 +96,55 @@ func (h tcpHandler) HandleRequest(conn net.Conn) {
 	r := bufio.NewReader(conn)
 	w := bufio.NewWriter(conn)
 
+	if err := h.setIdleDeadline(conn); err != nil {
+		log.Println(err)
+		return
+	}
 	authField, err := read[AuthField](r, authFieldSize)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	if !auth(authField) {
-		fmt.Printf("authField: %v\n", authField)
-		log.Println("authentication failed")
+	credential, err := readBody(r, uint64(authField.CredentialSize))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	var state *tls.ConnectionState
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// the handshake is done by reading the auth field
+		cs := tlsConn.ConnectionState()
+		state = &cs
+	}
+	base := src.WithAuditSource(context.Background(), src.AuditSource{
+		RemoteAddr:   conn.RemoteAddr().String(),
+		ConnectionID: connID,
+	})
+	account, scope, err := h.auth(authField, credential, state)
+	h.recordAuth(base, authField, account, err)
+	if err != nil {
+		log.Printf("authentication failed: %v\n", err)
+		return
+	}
+	namespace := authField.namespaceString()
+	if err := src.ValidateNamespace(namespace); err != nil {
+		log.Println(err)
 		return
 	}
 
-	sessID := NewSessionID(util.GenULID)
+	sess := h.newSession(base, account, scope, namespace)
+	compression, codec := negotiateCompression(authField.Compression)
+	sess.codec = codec
 	buf := new(bytes.Buffer)
 	if err := binary.Write(
 		buf,
 		binary.BigEndian,
-		sessID,
+		sess.id,
 	); err != nil {
 		log.Println(err)
 		return
 	}
+	buf.WriteByte(compression)
 
 	_, err = w.Write(buf.Bytes())
 	if err != nil {
@@ -99,22 +156,28 @@ func (h tcpHandler) HandleRequest(conn net.Conn) {
 		return
 	}
 
-	log.Printf("auth ok session id: %v\n", sessID)
+	log.Printf("auth ok session id: %v\n", sess.id)
 
 	for {
+		if err := h.setIdleDeadline(conn); err != nil {
+			log.Println(err)
+			return
+		}
 		header, err := read[HeaderField](r, headerFieldSize)
 		if err == io.EOF {
 			break
 		}
+		if isTimeout(err) {
+			log.Printf("idle timeout, connection %s\n", connID)
+			return
+		}
 		if err != nil {
 			log.Println(err)
 			return
 		}
-		if header.SessionID != sessID {
-			log.Println("session id mismatch")
-			log.Printf("header.sessionIDString(): %p\n", []byte(header.String()))
-			log.Printf("sessID.String(): %p\n", []byte(sessID.String()))
-			res, err := NewResponse(Error, []byte("session timeout")).encode()
+		if header.SessionID != sess.id {
+			log.Printf("session id mismatch: %s\n", header.SessionID)
+			res, err := NewResponse(Error, []byte("invalid session id")).encode()
 			if err != nil {
 				log.Printf("error: %v\n", err)
 			}
@@ -130,57 +193,273 @@ func (h tcpHandler) HandleRequest(conn net.Conn) {
 
 		log.Printf("header: %+v\n", header)
 
-		app := src.NewMessageQueueApplication(h.mqManager)
+		app := src.NewMessageQueueApplication(h.mqManager, h.cfg.Audit)
+		userID, queueName := header.queueRef(sess.accountID)
+		ctx := sess.ctx
 		resData, err := func() ([]byte, error) {
+			if sess.expired(time.Now()) && header.Command != ReAuthCMD {
+				if err := skipBody(r, header); err != nil {
+					return nil, err
+				}
+				return nil, ErrSessionExpired
+			}
+			// bodies are allocated as sent, so all but messages are kept small
+			if header.Command != PublishCMD && header.DataSize > maxCommandBodySize {
+				if err := skipBody(r, header); err != nil {
+					return nil, err
+				}
+				return nil, fmt.Errorf("%w: command body of %d bytes is larger than %d", src.ErrInvalidArgument, header.DataSize, maxCommandBodySize)
+			}
+
 			switch header.Command {
 			case PingCMD:
 				log.Println("PingCMD")
 				return []byte("pong"), nil
 			case CreateQueueCMD:
 				log.Println("CreateQueueCMD")
-				if err := app.CreateQueue(context.Background(), authField.accountIDString(), header.queueNameString()); err != nil {
+				body, err := readBody(r, header.DataSize)
+				if err != nil {
+					return nil, err
+				}
+				attrs, err := src.DecodeQueueAttributes(body)
+				if err != nil {
+					return nil, err
+				}
+				if err := app.CreateQueue(ctx, userID, queueName, attrs); err != nil {
 					return nil, err
 				}
 				return nil, nil
 			case ListQueueCMD:
 				log.Println("ListQueueCMD")
-				out, err := app.ListQueues(context.Background(), authField.accountIDString())
+				body, err := readBody(r, header.DataSize)
+				if err != nil {
+					return nil, err
+				}
+				in, err := src.DecodeListQueuesInput(body)
+				if err != nil {
+					return nil, err
+				}
+				out, err := app.ListQueues(ctx, userID, in)
 				if err != nil {
 					return nil, err
 				}
 				return out.EncodeJSON()
 			case DeleteQueueCMD:
 				log.Println("DeleteQueueCMD")
-				if err := app.DeleteQueue(context.Background(), authField.accountIDString(), header.queueNameString()); err != nil {
+				if err := app.DeleteQueue(ctx, userID, queueName); err != nil {
 					return nil, err
 				}
 				return nil, nil
 			case PublishCMD:
 				log.Println("PublishCMD")
-				data := make([]byte, header.DataSize)
-				_, err := r.Read(data)
+				// read and decompressed up to the max message size of the owner
+				limit := h.cfg.maxMessageSize(h.mqManager.Quota(userID))
+				if header.DataSize > uint64(limit) {
+					if err := skipBody(r, header); err != nil {
+						return nil, err
+					}
+					return nil, fmt.Errorf("%w: message of %d bytes is larger than max message size %d", src.ErrInvalidArgument, header.DataSize, limit)
+				}
+				data, err := readBody(r, header.DataSize)
 				if err != nil {
 					return nil, err
 				}
-				fmt.Printf("data: %v\n", data)
-				return nil, app.Publish(context.Background(), authField.accountIDString(), header.queueNameString(), data)
+				if data, err = sess.codec.Decode(data, limit); err != nil {
+					return nil, err
+				}
+				_, err = app.Publish(ctx, userID, queueName, data)
+				return nil, err
 			case ConsumeCMD:
 				log.Println("ConsumeCMD")
-				m, err := app.Consume(context.Background(), authField.accountIDString(), header.queueNameString())
+				m, err := app.Consume(ctx, userID, queueName)
 				if err != nil {
 					return nil, err
 				}
+				if m.Data, err = sess.codec.Encode(m.Data); err != nil {
+					return nil, err
+				}
 				return m.Bytes(), nil
 			case DeleteCMD:
 				log.Println("DeleteCMD")
 				var id MessageID
-				_, err := r.Read(id[:])
-				if err != nil && err != io.EOF {
+				if _, err := io.ReadFull(r, id[:]); err != nil {
 					return nil, err
 				}
 
 				log.Printf("delete message id: %v\n", string(id[:]))
-				return nil, app.Delete(context.Background(), authField.accountIDString(), header.queueNameString(), string(id[:]))
+				return nil, app.Delete(ctx, userID, queueName, string(id[:]))
+			case NackCMD:
+				log.Println("NackCMD")
+				nack, err := read[NackField](r, nackFieldSize)
+				if err != nil {
+					return nil, err
+				}
+
+				log.Printf("nack message id: %v\n", nack.messageIDString())
+				return nil, app.Nack(ctx, userID, queueName,
+					nack.messageIDString(), nack.delay(), nack.IncrementReceiveCount != 0)
+			case PurgeQueueCMD:
+				log.Println("PurgeQueueCMD")
+				out, err := app.PurgeQueue(ctx, userID, queueName)
+				if err != nil {
+					return nil, err
+				}
+				return out.EncodeJSON()
+			case BrowseQueueCMD:
+				log.Println("BrowseQueueCMD")
+				body, err := readBody(r, header.DataSize)
+				if err != nil {
+					return nil, err
+				}
+				in, err := src.DecodeBrowseQueueInput(body)
+				if err != nil {
+					return nil, err
+				}
+				out, err := app.BrowseQueue(ctx, userID, queueName, in)
+				if err != nil {
+					return nil, err
+				}
+				return out.EncodeJSON()
+			case GetQueueAttributesCMD:
+				log.Println("GetQueueAttributesCMD")
+				out, err := app.GetQueueAttributes(ctx, userID, queueName)
+				if err != nil {
+					return nil, err
+				}
+				return out.EncodeJSON()
+			case SetQueueAttributesCMD:
+				log.Println("SetQueueAttributesCMD")
+				body, err := readBody(r, header.DataSize)
+				if err != nil {
+					return nil, err
+				}
+				return nil, app.SetQueueAttributes(ctx, userID, queueName, body)
+			case PauseQueueCMD, ResumeQueueCMD:
+				log.Println("PauseQueueCMD/ResumeQueueCMD")
+				body, err := readBody(r, header.DataSize)
+				if err != nil {
+					return nil, err
+				}
+				in, err := src.DecodePauseQueueInput(body)
+				if err != nil {
+					return nil, err
+				}
+				if header.Command == PauseQueueCMD {
+					return nil, app.PauseQueue(ctx, userID, queueName, in)
+				}
+				return nil, app.ResumeQueue(ctx, userID, queueName, in)
+			case RenameQueueCMD:
+				log.Println("RenameQueueCMD")
+				body, err := readBody(r, header.DataSize)
+				if err != nil {
+					return nil, err
+				}
+				return nil, app.RenameQueue(ctx, userID, queueName, string(body))
+			case TransferQueueCMD:
+				log.Println("TransferQueueCMD")
+				body, err := readBody(r, header.DataSize)
+				if err != nil {
+					return nil, err
+				}
+				return nil, app.TransferQueue(ctx, userID, queueName, string(body))
+			case TagQueueCMD:
+				log.Println("TagQueueCMD")
+				body, err := readBody(r, header.DataSize)
+				if err != nil {
+					return nil, err
+				}
+				tags, err := src.DecodeTags(body)
+				if err != nil {
+					return nil, err
+				}
+				return nil, app.TagQueue(ctx, userID, queueName, tags)
+			case UntagQueueCMD:
+				log.Println("UntagQueueCMD")
+				body, err := readBody(r, header.DataSize)
+				if err != nil {
+					return nil, err
+				}
+				keys, err := src.DecodeTagKeys(body)
+				if err != nil {
+					return nil, err
+				}
+				return nil, app.UntagQueue(ctx, userID, queueName, keys)
+			case ListQueueTagsCMD:
+				log.Println("ListQueueTagsCMD")
+				out, err := app.ListQueueTags(ctx, userID, queueName)
+				if err != nil {
+					return nil, err
+				}
+				return out.EncodeJSON()
+			case PurgeQueuesCMD, DeleteQueuesCMD:
+				log.Println("PurgeQueuesCMD/DeleteQueuesCMD")
+				body, err := readBody(r, header.DataSize)
+				if err != nil {
+					return nil, err
+				}
+				var out src.BulkQueuesOutput
+				if header.Command == PurgeQueuesCMD {
+					out, err = app.PurgeQueues(ctx, userID, string(body))
+				} else {
+					out, err = app.DeleteQueues(ctx, userID, string(body))
+				}
+				if err != nil {
+					return nil, err
+				}
+				return out.EncodeJSON()
+			case GrantAccessCMD:
+				log.Println("GrantAccessCMD")
+				body, err := readBody(r, header.DataSize)
+				if err != nil {
+					return nil, err
+				}
+				g, err := src.DecodeGrant(body)
+				if err != nil {
+					return nil, err
+				}
+				return nil, app.GrantAccess(ctx, userID, g)
+			case RevokeAccessCMD:
+				log.Println("RevokeAccessCMD")
+				body, err := readBody(r, header.DataSize)
+				if err != nil {
+					return nil, err
+				}
+				in, err := src.DecodeRevokeAccessInput(body)
+				if err != nil {
+					return nil, err
+				}
+				return nil, app.RevokeAccess(ctx, userID, in.Grantee, in.Queue)
+			case ListGrantsCMD:
+				log.Println("ListGrantsCMD")
+				out, err := app.ListGrants(ctx, userID)
+				if err != nil {
+					return nil, err
+				}
+				return out.EncodeJSON()
+			case AccountInfoCMD:
+				log.Println("AccountInfoCMD")
+				out, err := app.AccountInfo(ctx, userID)
+				if err != nil {
+					return nil, err
+				}
+				return out.EncodeJSON()
+			case ReAuthCMD:
+				log.Println("ReAuthCMD")
+				body, err := readBody(r, header.DataSize)
+				if err != nil {
+					return nil, err
+				}
+				renewed, err := h.reauth(base, sess, body, state)
+				if err != nil {
+					return nil, err
+				}
+				sess = renewed
+				log.Printf("reauth ok session id: %v\n", sess.id)
+				buf := new(bytes.Buffer)
+				if err := binary.Write(buf, binary.BigEndian, sess.id); err != nil {
+					return nil, err
+				}
+				return buf.Bytes(), nil
 			default:
 				log.Println("invalid cmd")
 				if header.isBlank() {
@@ -192,7 +471,7 @@ func (h tcpHandler) HandleRequest(conn net.Conn) {
 		res, err := func() ([]byte, error) {
 			if err != nil {
 				log.Printf("error: %v\n", err)
-				return NewResponse(Error, []byte(err.Error())).encode()
+				return newErrorResponse(err).encode()
 			}
 			return NewResponse(OK, resData).encode()
 		}()
@@ -249,10 +528,6 @@ const (
 		8 // data size field
 )
 
-func init() {
-	fmt.Printf("headerFieldSize: %v\n", headerFieldSize)
-}
-
 // HeaderField ...
 type HeaderField struct {
 	SessionID SessionID
@@ -278,9 +553,42 @@ func (h HeaderField) queueNameString() string {
 	return strings.Replace(string(h.QueueName[:]), "\x00", "", -1)
 }
 
+// queueRef returns the account and name of the queue. The queue name field
+// is either a name of a queue of the authenticated account, or
+// "<account ID>/<queue name>" for a queue of another account, which needs a
+// grant of that account.
+func (h HeaderField) queueRef(accountID string) (string, string) {
+	name := h.queueNameString()
+	if owner, queue, ok := strings.Cut(name, "/"); ok {
+		return owner, queue
+	}
+	return accountID, name
+}
+
 // MessageID ...
 type MessageID [src.MessageIDSize]byte
 
+const nackFieldSize = src.MessageIDSize +
+	8 + // delay field size
+	1 // increment receive count field size
+
+// NackField follows the header of NackCMD.
+type NackField struct {
+	MessageID             MessageID
+	DelayMillis           uint64
+	IncrementReceiveCount uint8
+}
+
+// messageIDString ...
+func (n NackField) messageIDString() string {
+	return util.TrimNullChar(string(n.MessageID[:]))
+}
+
+// delay ...
+func (n NackField) delay() time.Duration {
+	return time.Duration(n.DelayMillis) * time.Millisecond
+}
+
 // read ...
 func read[T any](r io.Reader, bufSize uint64) (T, error) {
 	var v T
@@ -298,63 +606,146 @@ func read[T any](r io.Reader, bufSize uint64) (T, error) {
 	return v, nil
 }
 
-// auth ...
-func auth(a AuthField) bool {
-	if disableAuth, _ := strconv.ParseBool(os.Getenv("DISABLE_AUTH")); disableAuth {
-		return true
-	}
-
-	type Users map[string]string
-	users := make(Users)
-	users[accountIDTest] = passwordTest
+// maxCommandBodySize is the largest body of commands other than PublishCMD,
+// which fits ReAuthCMD with the largest credential.
+const maxCommandBodySize = authFieldSize + math.MaxUint16
 
-	if _, ok := users[a.accountIDString()]; !ok {
-		return false
+// readBody reads the data following a header.
+func readBody(r io.Reader, size uint64) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
 	}
-	if users[a.accountIDString()] != a.passwordString() {
-		log.Println("invalid password")
-		return false
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
 	}
+	return data, nil
+}
 
-	// Check if the username and password are valid
-	// if _, ok := users[a.accountIDString()]; !ok || users[a.accountIDString()] != a.passwordString() {
-	// 	// The username or password is invalid
-	// 	return false
-	// }
+// auth checks the credentials of the handshake against the account store,
+// the JWT verifier for AuthJWT, or the client certificate in state for
+// AuthCertificate. The scope of the API key or token is returned.
+func (h tcpHandler) auth(a AuthField, credential []byte, state *tls.ConnectionState) (src.Account, *src.APIKeyScope, error) {
+	if authDisabled() {
+		return src.Account{ID: a.accountIDString()}, nil, nil
+	}
 
-	return true
+	var (
+		account src.Account
+		scope   *src.APIKeyScope
+		err     error
+	)
+	switch a.Mechanism {
+	case AuthPassword:
+		if h.cfg.Accounts == nil {
+			return src.Account{}, nil, fmt.Errorf("%w: no account store", src.ErrUnauthenticated)
+		}
+		account, err = h.cfg.Accounts.Authenticate(a.accountIDString(), a.passwordString())
+		if err != nil {
+			return src.Account{}, nil, err
+		}
+		return account, nil, nil
+	case AuthAPIKey:
+		if h.cfg.Accounts == nil {
+			return src.Account{}, nil, fmt.Errorf("%w: no account store", src.ErrUnauthenticated)
+		}
+		var key src.APIKey
+		account, key, err = h.cfg.Accounts.AuthenticateAPIKey(string(credential))
+		scope = key.Scope
+	case AuthJWT:
+		if h.cfg.JWT == nil {
+			return src.Account{}, nil, fmt.Errorf("%w: JWTs are not enabled", src.ErrUnauthenticated)
+		}
+		account, scope, err = h.cfg.JWT.Verify(string(credential))
+	case AuthCertificate:
+		account, err = h.cfg.certAccount(state)
+	default:
+		return src.Account{}, nil, fmt.Errorf("%w: unknown auth mechanism %d", src.ErrUnauthenticated, a.Mechanism)
+	}
+	if err != nil {
+		return src.Account{}, nil, err
+	}
+	// the account ID field may be left empty, but must not name another account
+	if id := a.accountIDString(); id != "" && id != account.ID {
+		return src.Account{}, nil, fmt.Errorf("%w: credentials of account \"%s\" are used as account \"%s\"", src.ErrUnauthenticated, account.ID, id)
+	}
+	return account, scope, nil
 }
 
 const (
-	accountIDStrSize = 32
-	passwordStrSize  = 64
+	accountIDStrSize = src.MaxAccountIDLength
+	passwordStrSize  = src.MaxPasswordLength
+	namespaceStrSize = src.MaxQueueNameLength
 	authFieldSize    = accountIDStrSize*ByteSizeOfRune +
-		passwordStrSize*ByteSizeOfRune
+		passwordStrSize*ByteSizeOfRune +
+		namespaceStrSize*ByteSizeOfRune +
+		1 + // mechanism field size
+		2 + // credential size field size
+		1 // compression field size
 )
 
 const (
-	accountIDTest = "01HG17X22440GTQW3AS6WHCF0K" // ulid
-	passwordTest  = "P@ssw0rd"
+	// AuthPassword authenticates by the account ID and password fields.
+	AuthPassword uint8 = iota
+	// AuthAPIKey authenticates by an API key of CredentialSize bytes
+	// following the auth field. The account ID field may be left empty.
+	AuthAPIKey
+	// AuthJWT authenticates by a JWT of CredentialSize bytes following the
+	// auth field. The account ID field may be left empty.
+	AuthJWT
+	// AuthCertificate authenticates by the verified TLS client certificate,
+	// whose subject common name is the account ID.
+	AuthCertificate
 )
 
+const (
+	// WireCompressionNone sends message payloads as they are.
+	WireCompressionNone uint8 = iota
+	// WireCompressionGzip sends the payloads of PublishCMD bodies and
+	// ConsumeCMD responses, after the message ID, compressed with gzip.
+	WireCompressionGzip
+	// WireCompressionDeflate is WireCompressionGzip with raw deflate.
+	WireCompressionDeflate
+)
+
+// negotiateCompression returns the wire compression answering the one
+// requested, which falls back to none when unknown, and its codec.
+func negotiateCompression(requested uint8) (uint8, src.Codec) {
+	switch requested {
+	case WireCompressionGzip:
+		return requested, src.CodecGzip
+	case WireCompressionDeflate:
+		return requested, src.CodecDeflate
+	default:
+		return WireCompressionNone, src.CodecNone
+	}
+}
+
 // AuthField ...
 type AuthField struct {
-	AccountID [32]rune
-	Password  [64]rune
+	AccountID [accountIDStrSize]rune
+	Password  [passwordStrSize]rune
+	// Namespace selects the namespace of the account the session works in.
+	// Null characters select the default namespace.
+	Namespace [namespaceStrSize]rune
+	Mechanism uint8
+	// CredentialSize is the size of the credential following the field
+	// for mechanisms other than AuthPassword.
+	CredentialSize uint16
+	// Compression requests compressed message payloads on the wire. The
+	// server answers the compression it uses after the session ID.
+	Compression uint8
 }
 
 // String ...
 func (a AuthField) String() string {
-	return fmt.Sprintf("{AccountID:%s, Password:%s}",
-		a.accountIDString(), a.passwordString())
+	return fmt.Sprintf("{AccountID:%s, Namespace:%s, Mechanism:%d}",
+		a.accountIDString(), a.namespaceString(), a.Mechanism)
 }
 
 // accountIDString ...
 func (a AuthField) accountIDString() string {
 	accountID := string(a.AccountID[:])
-	if accountID == "" {
-		return accountIDTest
-	}
 	return util.TrimNullChar(accountID)
 }
 
@@ -364,6 +755,12 @@ func (a AuthField) passwordString() string {
 	return util.TrimNullChar(password)
 }
 
+// namespaceString ...
+func (a AuthField) namespaceString() string {
+	namespace := string(a.Namespace[:])
+	return util.TrimNullChar(namespace)
+}
+
 // Response ...
 type Response struct {
 	HeaderField struct {
@@ -382,6 +779,29 @@ func NewResponse(result uint8, data []byte) Response {
 	return res
 }
 
+// newErrorResponse is the response for err.
+func newErrorResponse(err error) Response {
+	data := []byte(err.Error())
+	if retryAfter, ok := src.RetryAfter(err); ok {
+		data = append(binary.BigEndian.AppendUint32(nil, uint32(retryAfter.Milliseconds())), data...)
+	}
+	return NewResponse(errorResult(err), data)
+}
+
+// errorResult is the result code of a response for err.
+func errorResult(err error) uint8 {
+	switch {
+	case errors.Is(err, src.ErrQueuePaused):
+		return Paused
+	case errors.Is(err, ErrSessionExpired):
+		return SessionExpired
+	case errors.Is(err, src.ErrThrottled):
+		return Throttled
+	default:
+		return Error
+	}
+}
+
 // encode ...
 func (res Response) encode() ([]byte, error) {
 	buf := new(bytes.Buffer)
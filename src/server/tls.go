@@ -0,0 +1,154 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/verniyyy/verniy-mq/src"
+)
+
+// ClientAuth values of TLSOptions.
+const (
+	// ClientAuthNone does not ask for client certificates.
+	ClientAuthNone = "none"
+	// ClientAuthOptional verifies client certificates when they are given.
+	ClientAuthOptional = "optional"
+	// ClientAuthRequire rejects clients without a verified certificate.
+	ClientAuthRequire = "require"
+)
+
+// TLSOptions configures TLS of the TCP and HTTP listeners.
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile holds the PEM certificates client certificates are
+	// verified against. Required unless ClientAuth is ClientAuthNone.
+	ClientCAFile string
+	// ClientAuth is ClientAuthNone, ClientAuthOptional or ClientAuthRequire.
+	ClientAuth string
+}
+
+// NewTLSConfig returns a TLS config of opts. The certificate, key and
+// client CA files are reloaded on new connections after they change.
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	clientAuth := tls.NoClientCert
+	switch opts.ClientAuth {
+	case "", ClientAuthNone:
+	case ClientAuthOptional:
+		clientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth \"%s\"", opts.ClientAuth)
+	}
+	if clientAuth != tls.NoClientCert && opts.ClientCAFile == "" {
+		return nil, errors.New("client auth needs a client CA file")
+	}
+
+	r := &tlsReloader{opts: opts}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: clientAuth,
+	}
+	cfg := base.Clone()
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, clientCAs := r.current()
+		c := base.Clone()
+		c.Certificates = []tls.Certificate{cert}
+		c.ClientCAs = clientCAs
+		return c, nil
+	}
+	return cfg, nil
+}
+
+// tlsReloader keeps the certificate and the client CAs of the files in
+// opts, reloading them when the files change.
+type tlsReloader struct {
+	opts TLSOptions
+
+	mu        sync.Mutex
+	cert      tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  [3]time.Time
+}
+
+// current returns the certificate and the client CAs, reloading them when
+// the files changed. The ones loaded before are kept when reloading fails.
+func (r *tlsReloader) current() (tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.reload(); err != nil {
+		log.Printf("tls: %v\n", err)
+	}
+	return r.cert, r.clientCAs
+}
+
+// reload reads the files when one of them has changed since the last read.
+// r.mu must be held except when r is created.
+func (r *tlsReloader) reload() error {
+	var modTimes [3]time.Time
+	for i, path := range []string{r.opts.CertFile, r.opts.KeyFile, r.opts.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	if modTimes == r.modTimes {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return err
+	}
+	var clientCAs *x509.CertPool
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates in %s", r.opts.ClientCAFile)
+		}
+	}
+	if !r.modTimes[0].IsZero() {
+		log.Printf("tls: reloaded %s\n", r.opts.CertFile)
+	}
+	r.cert, r.clientCAs, r.modTimes = cert, clientCAs, modTimes
+	return nil
+}
+
+// certAccount returns the account named by the subject common name of the
+// verified client certificate of state.
+func (c Config) certAccount(state *tls.ConnectionState) (src.Account, error) {
+	if !c.CertAccounts {
+		return src.Account{}, fmt.Errorf("%w: client certificates do not authenticate accounts", src.ErrUnauthenticated)
+	}
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return src.Account{}, fmt.Errorf("%w: no verified client certificate", src.ErrUnauthenticated)
+	}
+	if c.Accounts == nil {
+		return src.Account{}, fmt.Errorf("%w: no account store", src.ErrUnauthenticated)
+	}
+
+	accountID := state.VerifiedChains[0][0].Subject.CommonName
+	account, err := c.Accounts.Get(accountID)
+	if err != nil {
+		return src.Account{}, fmt.Errorf("%w: client certificate of \"%s\": %v", src.ErrUnauthenticated, accountID, err)
+	}
+	return account, nil
+}
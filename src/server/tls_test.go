@@ -0,0 +1,259 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/verniyyy/verniy-mq/src"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "localhost", ca)
+	certFile, keyFile, caFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.pem")
+	server.write(t, certFile, keyFile)
+	ca.write(t, caFile, filepath.Join(dir, "ca.key"))
+
+	tests := []struct {
+		name    string
+		opts    TLSOptions
+		wantErr bool
+	}{
+		{name: "server only", opts: TLSOptions{CertFile: certFile, KeyFile: keyFile}},
+		{name: "client auth", opts: TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: ClientAuthRequire}},
+		{name: "unknown client auth", opts: TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientAuth: "sometimes"}, wantErr: true},
+		{name: "client auth without CA", opts: TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthOptional}, wantErr: true},
+		{name: "missing key", opts: TLSOptions{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.key")}, wantErr: true},
+		{name: "CA without certificates", opts: TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile, ClientAuth: ClientAuthOptional}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTLSConfig(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_tlsReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	first := newTestCert(t, "localhost", ca)
+	first.write(t, certFile, keyFile)
+	loaded := time.Now().Add(-time.Hour)
+	setModTime(t, loaded, certFile, keyFile)
+
+	cfg, err := NewTLSConfig(TLSOptions{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := func() *big.Int {
+		t.Helper()
+		c, err := cfg.GetConfigForClient(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(c.Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.SerialNumber
+	}
+	if got := serial(); got.Cmp(first.cert.SerialNumber) != 0 {
+		t.Fatalf("serial = %v, want %v", got, first.cert.SerialNumber)
+	}
+
+	// files of the same modification time are not read again
+	second := newTestCert(t, "localhost", ca)
+	second.write(t, certFile, keyFile)
+	setModTime(t, loaded, certFile, keyFile)
+	if got := serial(); got.Cmp(first.cert.SerialNumber) != 0 {
+		t.Fatalf("serial of unchanged files = %v, want %v", got, first.cert.SerialNumber)
+	}
+	setModTime(t, time.Now(), certFile, keyFile)
+	if got := serial(); got.Cmp(second.cert.SerialNumber) != 0 {
+		t.Fatalf("serial after changing the files = %v, want %v", got, second.cert.SerialNumber)
+	}
+
+	// a broken key keeps the certificate loaded before
+	if err := os.WriteFile(keyFile, []byte("broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	setModTime(t, time.Now().Add(time.Hour), keyFile)
+	if got := serial(); got.Cmp(second.cert.SerialNumber) != 0 {
+		t.Errorf("serial after breaking the key = %v, want %v", got, second.cert.SerialNumber)
+	}
+}
+
+func TestConfig_certAccount(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	accounts := newTestAccountStore(t, "alice")
+	chain := func(cn string) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{newTestCert(t, cn, ca).cert, ca.cert}}}
+	}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		state   *tls.ConnectionState
+		want    string
+		wantErr error
+	}{
+		{name: "account", cfg: Config{Accounts: accounts, CertAccounts: true}, state: chain("alice"), want: "alice"},
+		{name: "unknown account", cfg: Config{Accounts: accounts, CertAccounts: true}, state: chain("mallory"), wantErr: src.ErrUnauthenticated},
+		{name: "disabled", cfg: Config{Accounts: accounts}, state: chain("alice"), wantErr: src.ErrUnauthenticated},
+		{name: "no state", cfg: Config{Accounts: accounts, CertAccounts: true}, wantErr: src.ErrUnauthenticated},
+		{name: "unverified", cfg: Config{Accounts: accounts, CertAccounts: true}, state: &tls.ConnectionState{}, wantErr: src.ErrUnauthenticated},
+		{name: "no account store", cfg: Config{CertAccounts: true}, state: chain("alice"), wantErr: src.ErrUnauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account, err := tt.cfg.certAccount(tt.state)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("certAccount() error = %v, want %v", err, tt.wantErr)
+			}
+			if account.ID != tt.want {
+				t.Errorf("certAccount() = %v, want %v", account.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_clientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	certFile, keyFile, caFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.pem")
+	newTestCert(t, "localhost", ca).write(t, certFile, keyFile)
+	ca.write(t, caFile, filepath.Join(dir, "ca.key"))
+
+	tlsConfig, err := NewTLSConfig(TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: ClientAuthOptional})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ := newTestRouter(t, Config{CertAccounts: true})
+	srv := httptest.NewUnstartedServer(h)
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	tests := []struct {
+		name     string
+		cn       string
+		wantCode int
+	}{
+		{name: "account", cn: "alice", wantCode: http.StatusOK},
+		{name: "unknown account", cn: "mallory", wantCode: http.StatusUnauthorized},
+		{name: "no certificate", wantCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientTLS := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+			if tt.cn != "" {
+				clientTLS.Certificates = []tls.Certificate{newTestCert(t, tt.cn, ca).tlsCertificate()}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			res, err := client.Get(srv.URL + "/api/v1/vmq/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.wantCode {
+				t.Errorf("GET = %d, want %d", res.StatusCode, tt.wantCode)
+			}
+		})
+	}
+}
+
+// testCert is a certificate with its key.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert returns a certificate of the common name cn issued by parent,
+// or a self-signed CA when parent is nil.
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	issuer, signer := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+// write writes the certificate and the key as PEM files.
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tlsCertificate ...
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+// setModTime sets the modification time of files.
+func setModTime(t *testing.T, mtime time.Time, files ...string) {
+	t.Helper()
+	for _, f := range files {
+		if err := os.Chtimes(f, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
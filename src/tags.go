@@ -0,0 +1,74 @@
+package src
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	maxTagsPerQueue = 50
+	maxTagKeyLen    = 128
+	maxTagValueLen  = 256
+)
+
+// ValidateTags checks tags to be set on a queue.
+func ValidateTags(tags map[string]string) error {
+	for k, v := range tags {
+		if k == "" || len(k) > maxTagKeyLen {
+			return fmt.Errorf("%w: tag key must be 1 to %d characters", ErrInvalidArgument, maxTagKeyLen)
+		}
+		if strings.ContainsAny(k, "=,") {
+			return fmt.Errorf("%w: tag key \"%s\" must not contain '=' or ','", ErrInvalidArgument, k)
+		}
+		if len(v) > maxTagValueLen {
+			return fmt.Errorf("%w: tag value of \"%s\" must be up to %d characters", ErrInvalidArgument, k, maxTagValueLen)
+		}
+	}
+	return nil
+}
+
+// TagSelector selects queues by their tags. All requirements must be met.
+type TagSelector []tagRequirement
+
+// tagRequirement is either a key=value pair or, without value, the presence of a key.
+type tagRequirement struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// ParseTagSelector parses a comma separated list of key=value pairs or
+// keys, e.g. "team=payments,env=prod,critical".
+func ParseTagSelector(s string) (TagSelector, error) {
+	var sel TagSelector
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		k, v, hasValue := strings.Cut(term, "=")
+		k = strings.TrimSpace(k)
+		if k == "" {
+			return nil, fmt.Errorf("%w: invalid tag selector: \"%s\"", ErrInvalidArgument, s)
+		}
+		sel = append(sel, tagRequirement{key: k, value: strings.TrimSpace(v), hasValue: hasValue})
+	}
+	return sel, nil
+}
+
+// Empty reports whether the selector selects every queue.
+func (sel TagSelector) Empty() bool {
+	return len(sel) == 0
+}
+
+// Matches ...
+func (sel TagSelector) Matches(tags map[string]string) bool {
+	for _, r := range sel {
+		v, ok := tags[r.key]
+		if !ok || (r.hasValue && v != r.value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,285 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestValidateTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    map[string]string
+		wantErr error
+	}{
+		{name: "none", tags: nil},
+		{name: "valid", tags: map[string]string{"team": "payments", "critical": ""}},
+		{name: "longest", tags: map[string]string{strings.Repeat("k", maxTagKeyLen): strings.Repeat("v", maxTagValueLen)}},
+		{name: "empty key", tags: map[string]string{"": "x"}, wantErr: ErrInvalidArgument},
+		{name: "long key", tags: map[string]string{strings.Repeat("k", maxTagKeyLen+1): "x"}, wantErr: ErrInvalidArgument},
+		{name: "long value", tags: map[string]string{"team": strings.Repeat("v", maxTagValueLen+1)}, wantErr: ErrInvalidArgument},
+		{name: "key with =", tags: map[string]string{"team=x": "y"}, wantErr: ErrInvalidArgument},
+		{name: "key with ,", tags: map[string]string{"a,b": "y"}, wantErr: ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateTags(tt.tags); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateTags() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseTagSelector(t *testing.T) {
+	tags := map[string]string{"team": "payments", "env": "prod", "critical": ""}
+	tests := []struct {
+		name        string
+		s           string
+		want        TagSelector
+		wantMatches bool
+		wantErr     error
+	}{
+		{name: "empty", s: "", wantMatches: true},
+		{name: "blank terms", s: " , ,", wantMatches: true},
+		{
+			name:        "pairs and keys",
+			s:           "team=payments, env = prod ,critical",
+			want:        TagSelector{{key: "team", value: "payments", hasValue: true}, {key: "env", value: "prod", hasValue: true}, {key: "critical"}},
+			wantMatches: true,
+		},
+		{name: "empty value", s: "critical=", want: TagSelector{{key: "critical", hasValue: true}}, wantMatches: true},
+		{name: "other value", s: "team=search", want: TagSelector{{key: "team", value: "search", hasValue: true}}},
+		{name: "missing key", s: "team,owner", want: TagSelector{{key: "team"}, {key: "owner"}}},
+		{name: "empty value of a key with value", s: "team=", want: TagSelector{{key: "team", hasValue: true}}},
+		{name: "no key", s: "=payments", wantErr: ErrInvalidArgument},
+		{name: "no key after a pair", s: "team=payments, =prod", wantErr: ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTagSelector(tt.s)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseTagSelector() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTagSelector() = %+v, want %+v", got, tt.want)
+			}
+			if err == nil && got.Matches(tags) != tt.wantMatches {
+				t.Errorf("Matches() = %v, want %v", !tt.wantMatches, tt.wantMatches)
+			}
+		})
+	}
+}
+
+func Test_mqManager_TagQueue(t *testing.T) {
+	owner := Owner{AccountID: "producer"}
+	tooMany := make(map[string]string, maxTagsPerQueue)
+	for i := 0; i < maxTagsPerQueue; i++ {
+		tooMany[strings.Repeat("k", i+1)] = ""
+	}
+
+	tests := []struct {
+		name     string
+		tag      map[string]string
+		untag    []string
+		queue    string
+		wantTags map[string]string
+		wantErr  error
+	}{
+		{name: "add", tag: map[string]string{"owner": "alice"}, wantTags: map[string]string{"team": "payments", "env": "prod", "owner": "alice"}},
+		{name: "replace", tag: map[string]string{"env": "staging"}, wantTags: map[string]string{"team": "payments", "env": "staging"}},
+		{name: "untag", untag: []string{"env", "missing"}, wantTags: map[string]string{"team": "payments"}},
+		{name: "invalid tags", tag: map[string]string{"": "x"}, wantTags: map[string]string{"team": "payments", "env": "prod"}, wantErr: ErrInvalidArgument},
+		{name: "too many tags", tag: tooMany, wantTags: map[string]string{"team": "payments", "env": "prod"}, wantErr: ErrInvalidArgument},
+		{name: "tag a missing queue", queue: "missing", tag: map[string]string{"a": "b"}, wantErr: ErrQueueNotFound},
+		{name: "untag a missing queue", queue: "missing", untag: []string{"a"}, wantErr: ErrQueueNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMQManager(MQManagerConfig{})
+			if err := m.CreateQueue(owner, "orders", QueueAttributes{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.TagQueue(owner, "orders", map[string]string{"team": "payments", "env": "prod"}); err != nil {
+				t.Fatal(err)
+			}
+
+			queue := tt.queue
+			if queue == "" {
+				queue = "orders"
+			}
+			var err error
+			if tt.tag != nil {
+				err = m.TagQueue(owner, queue, tt.tag)
+			} else {
+				err = m.UntagQueue(owner, queue, tt.untag)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantTags == nil {
+				return
+			}
+			if got, _ := m.QueueTags(owner, "orders"); !reflect.DeepEqual(got, tt.wantTags) {
+				t.Errorf("QueueTags() = %v, want %v", got, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestMessageQueueApplication_PurgeQueues(t *testing.T) {
+	admin := Principal{AccountID: "root", Admin: true}
+	tests := []struct {
+		name       string
+		principal  Principal
+		selector   string
+		wantQueues []string
+		wantPurged int64
+		wantErr    error
+	}{
+		{name: "by tag", principal: admin, selector: "team=payments", wantQueues: []string{"invoices", "orders"}, wantPurged: 2},
+		{name: "by key", principal: admin, selector: "critical", wantQueues: []string{"orders"}, wantPurged: 1},
+		{name: "no match", principal: admin, selector: "team=none", wantQueues: []string{}},
+		{name: "empty selector", principal: admin, selector: " ", wantErr: ErrInvalidArgument},
+		{name: "invalid selector", principal: admin, selector: "=x", wantErr: ErrInvalidArgument},
+		{name: "owner", principal: Principal{AccountID: "producer"}, selector: "team=payments", wantErr: ErrForbidden},
+		{name: "stranger", principal: Principal{AccountID: "bob"}, selector: "team=payments", wantErr: ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, m := newTaggedTestApplication(t)
+			ctx := WithPrincipal(context.Background(), tt.principal)
+
+			out, err := app.PurgeQueues(ctx, "producer", tt.selector)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PurgeQueues() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(out.Queues, tt.wantQueues) || out.Purged != tt.wantPurged {
+				t.Errorf("PurgeQueues() = %+v, want queues %v purged %d", out, tt.wantQueues, tt.wantPurged)
+			}
+			if got := m.Usage("producer").Messages; got != 3-tt.wantPurged {
+				t.Errorf("messages left = %d, want %d", got, 3-tt.wantPurged)
+			}
+		})
+	}
+}
+
+func TestMessageQueueApplication_DeleteQueues(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  Principal
+		selector   string
+		wantQueues []string
+		wantLeft   []string
+		wantErr    error
+	}{
+		{name: "by tag", principal: Principal{AccountID: "producer"}, selector: "team=payments", wantQueues: []string{"invoices", "orders"}, wantLeft: []string{"search"}},
+		{name: "by tags", principal: Principal{AccountID: "producer"}, selector: "team=payments,critical", wantQueues: []string{"orders"}, wantLeft: []string{"invoices", "search"}},
+		{name: "admin", principal: Principal{AccountID: "root", Admin: true}, selector: "team", wantQueues: []string{"invoices", "orders", "search"}, wantLeft: []string{}},
+		{name: "empty selector", principal: Principal{AccountID: "producer"}, selector: "", wantErr: ErrInvalidArgument},
+		{name: "stranger", principal: Principal{AccountID: "bob"}, selector: "team", wantErr: ErrForbidden},
+		{
+			name:      "scope without manage",
+			principal: Principal{AccountID: "producer", Scope: &APIKeyScope{Permissions: []Permission{PermissionDelete}}},
+			selector:  "team",
+			wantErr:   ErrForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, m := newTaggedTestApplication(t)
+			ctx := WithPrincipal(context.Background(), tt.principal)
+
+			out, err := app.DeleteQueues(ctx, "producer", tt.selector)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DeleteQueues() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(out.Queues, tt.wantQueues) {
+				t.Errorf("DeleteQueues() queues = %v, want %v", out.Queues, tt.wantQueues)
+			}
+			left, _ := m.ListQueues(Owner{AccountID: "producer"})
+			names := make([]string, 0, len(left))
+			for _, mq := range left {
+				names = append(names, mq.Name())
+			}
+			if !reflect.DeepEqual(names, tt.wantLeft) {
+				t.Errorf("queues left = %v, want %v", names, tt.wantLeft)
+			}
+		})
+	}
+}
+
+func Test_mqManager_Catalog(t *testing.T) {
+	m := NewMQManager(MQManagerConfig{})
+	queues := []struct {
+		owner Owner
+		name  string
+		tags  map[string]string
+	}{
+		{owner: Owner{AccountID: "alice"}, name: "orders", tags: map[string]string{"team": "payments"}},
+		{owner: Owner{AccountID: "alice", Namespace: "staging"}, name: "orders"},
+		{owner: Owner{AccountID: "bob"}, name: "search", tags: map[string]string{"team": "search"}},
+	}
+	for _, q := range queues {
+		if err := m.CreateQueue(q.owner, q.name, QueueAttributes{}); err != nil {
+			t.Fatal(err)
+		}
+		if q.tags != nil {
+			if err := m.TagQueue(q.owner, q.name, q.tags); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := m.DeleteQueue(Owner{AccountID: "bob"}, "search"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := m.Catalog()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Owner.String() < entries[j].Owner.String() })
+	if len(entries) != 2 {
+		t.Fatalf("Catalog() = %+v, want 2 queues", entries)
+	}
+	for i, e := range entries {
+		q := queues[i]
+		if e.Owner != q.owner || e.Name != q.name || e.Queue == nil || e.Queue.Name() != q.name {
+			t.Errorf("Catalog()[%d] = %+v, want %s of %v", i, e, q.name, q.owner)
+		}
+		if len(e.Tags) != len(q.tags) || (q.tags != nil && !reflect.DeepEqual(e.Tags, q.tags)) {
+			t.Errorf("Catalog()[%d].Tags = %v, want %v", i, e.Tags, q.tags)
+		}
+	}
+}
+
+// newTaggedTestApplication returns an application whose account producer has
+// the queues orders (team=payments, critical), invoices (team=payments) and
+// search (team=search) with a message each.
+func newTaggedTestApplication(t *testing.T) (MessageQueueApplication, MQManager) {
+	t.Helper()
+	m := NewMQManager(MQManagerConfig{})
+	owner := Owner{AccountID: "producer"}
+	for name, tags := range map[string]map[string]string{
+		"orders":   {"team": "payments", "critical": ""},
+		"invoices": {"team": "payments"},
+		"search":   {"team": "search"},
+	} {
+		if err := m.CreateQueue(owner, name, QueueAttributes{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.TagQueue(owner, name, tags); err != nil {
+			t.Fatal(err)
+		}
+		mq, _ := m.GetQueue(owner, name)
+		if err := mq.Publish(&Message{ID: name, Data: []byte("data")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewMessageQueueApplication(m, nil), m
+}
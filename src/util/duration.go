@@ -0,0 +1,46 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration that is encoded as a string such as "1m30s" in JSON.
+type Duration time.Duration
+
+// Std ...
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case nil:
+		// null leaves the duration unchanged like other JSON values
+	case string:
+		pd, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(pd)
+	case float64:
+		// a plain number is taken as seconds
+		*d = Duration(v * float64(time.Second))
+	default:
+		return fmt.Errorf("invalid duration: %s", string(b))
+	}
+
+	return nil
+}